@@ -1,17 +1,30 @@
 package main
 
 import (
+	"errors"
+	"os"
+
 	"fyne.io/fyne/v2/app"
+	"github.com/huzaifanur/ghpm/internal/cli"
 	"github.com/huzaifanur/ghpm/internal/config"
 	"github.com/huzaifanur/ghpm/internal/ui"
 	"github.com/huzaifanur/ghpm/pkg/logger"
 )
 
 func main() {
+	// Any arguments select the headless command line interface
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	logger := logger.New()
 	logger.Infow("Starting GHPM application")
 
 	cfg, err := config.LoadConfig()
+	if errors.Is(err, config.ErrVaultLocked) {
+		// the window asks for the master passphrase
+		cfg, err = config.NewConfig(), nil
+	}
 	if err != nil {
 		logger.Fatalw("Failed to load config", "error", err)
 	}
@@ -0,0 +1,375 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huzaifanur/ghpm/internal/fsutil"
+)
+
+const manifestName = "manifest.json"
+
+// encryptedSuffix ends the names of encrypted copies
+const encryptedSuffix = ".enc"
+
+// Store keeps timestamped snapshots of files ghpm is about to overwrite
+type Store struct {
+	dir    string
+	cipher Cipher
+}
+
+// Cipher encrypts the copies in snapshots, e.g. with the key of the profile
+// vault. path is the original location of a copy, so a copy cannot be
+// passed off as another file's.
+type Cipher interface {
+	// Enabled reports whether new copies are encrypted
+	Enabled() bool
+	Seal(path string, data []byte) ([]byte, error)
+	Open(path string, data []byte) ([]byte, error)
+}
+
+// Snapshot is one backup: copies of a set of files taken at the same time
+type Snapshot struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Reason    string    `json:"reason"`
+	Files     []File    `json:"files"`
+}
+
+// File is a single file in a snapshot
+type File struct {
+	Path string      `json:"path"` // original location
+	Name string      `json:"name"` // copy inside the snapshot directory
+	Mode os.FileMode `json:"mode"`
+	// Encrypted is set when the copy was sealed by the store's Cipher
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// SetCipher encrypts the copies of new snapshots while cipher is enabled,
+// and decrypts encrypted copies on restore
+func (s *Store) SetCipher(cipher Cipher) {
+	s.cipher = cipher
+}
+
+// Snapshot copies the existing files among paths into a new snapshot.
+// Paths that do not exist are skipped; if none exist no snapshot is created
+// and nil is returned.
+func (s *Store) Snapshot(reason string, paths ...string) (*Snapshot, error) {
+	type source struct {
+		path      string
+		data      []byte
+		mode      os.FileMode
+		encrypted bool
+	}
+
+	encrypt := s.cipher != nil && s.cipher.Enabled()
+
+	var sources []source
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if encrypt {
+			if data, err = s.cipher.Seal(path, data); err != nil {
+				return nil, fmt.Errorf("failed to encrypt the backup of %s: %w", path, err)
+			}
+		}
+		sources = append(sources, source{path: path, data: data, mode: info.Mode().Perm(), encrypted: encrypt})
+	}
+
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	snap := &Snapshot{
+		ID:        now.Format("20060102-150405.000"),
+		CreatedAt: now,
+		Reason:    reason,
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// never merge into an existing snapshot taken in the same millisecond
+	snapDir := filepath.Join(s.dir, snap.ID)
+	for n := 1; ; n++ {
+		err := os.Mkdir(snapDir, 0700)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		snap.ID = now.Format("20060102-150405.000") + "-" + strconv.Itoa(n)
+		snapDir = filepath.Join(s.dir, snap.ID)
+	}
+
+	used := make(map[string]bool)
+	for i, src := range sources {
+		name := filepath.Base(src.path)
+		if used[name] {
+			name = strconv.Itoa(i) + "_" + name
+		}
+		used[name] = true
+		if src.encrypted {
+			name = copyName(name, true)
+		}
+
+		if err := os.WriteFile(filepath.Join(snapDir, name), src.data, 0600); err != nil {
+			os.RemoveAll(snapDir)
+			return nil, fmt.Errorf("failed to back up %s: %w", src.path, err)
+		}
+		snap.Files = append(snap.Files, File{Path: src.path, Name: name, Mode: src.mode, Encrypted: src.encrypted})
+	}
+
+	if err := s.writeManifest(snap); err != nil {
+		os.RemoveAll(snapDir)
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+func (s *Store) writeManifest(snap *Snapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(s.dir, snap.ID, manifestName), data, 0600); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+	return nil
+}
+
+// SnapshotChanged snapshots the files among contents whose current content
+// differs from the content about to be written. Files that do not exist or
+// already hold the same bytes need no backup.
+func (s *Store) SnapshotChanged(reason string, contents map[string][]byte) (*Snapshot, error) {
+	var changed []string
+	for path, data := range contents {
+		existing, err := os.ReadFile(path)
+		if err == nil && !bytes.Equal(existing, data) {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return s.Snapshot(reason, changed...)
+}
+
+// List returns all snapshots, newest first
+func (s *Store) List() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		snap, err := s.Get(entry.Name())
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// Get loads the snapshot with the given ID
+func (s *Store) Get(id string) (*Snapshot, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, fmt.Errorf("invalid backup id %q", id)
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, id, manifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("backup '%s' not found", id)
+		}
+		return nil, fmt.Errorf("failed to read backup manifest: %w", err)
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to parse backup manifest: %w", err)
+	}
+	return &snap, nil
+}
+
+// Restore puts the files of a snapshot back at their original locations.
+// Files currently there with different content are snapshotted first, so a
+// restore can itself be undone.
+func (s *Store) Restore(id string) (*Snapshot, error) {
+	snap, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make(map[string][]byte, len(snap.Files))
+	for _, f := range snap.Files {
+		data, err := s.read(snap, f)
+		if err != nil {
+			return nil, err
+		}
+		contents[f.Path] = data
+	}
+
+	if _, err := s.SnapshotChanged("before restoring backup "+snap.ID, contents); err != nil {
+		return nil, fmt.Errorf("failed to back up current files: %w", err)
+	}
+
+	for _, f := range snap.Files {
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", f.Path, err)
+		}
+		if err := fsutil.WriteFileAtomic(f.Path, contents[f.Path], f.Mode); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", f.Path, err)
+		}
+	}
+
+	return snap, nil
+}
+
+// read returns the content of a file as it was when the snapshot was taken
+func (s *Store) read(snap *Snapshot, f File) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, snap.ID, f.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup of %s: %w", f.Path, err)
+	}
+	if !f.Encrypted {
+		return data, nil
+	}
+	if s.cipher == nil {
+		return nil, fmt.Errorf("the backup of %s is encrypted", f.Path)
+	}
+	if data, err = s.cipher.Open(f.Path, data); err != nil {
+		return nil, fmt.Errorf("failed to decrypt the backup of %s: %w", f.Path, err)
+	}
+	return data, nil
+}
+
+// EncryptAll encrypts the copies in all snapshots that are still stored in
+// plaintext, e.g. those taken before the cipher was enabled, and returns
+// how many it encrypted
+func (s *Store) EncryptAll() (int, error) {
+	return s.recrypt(true)
+}
+
+// DecryptAll stores the copies in all snapshots in plaintext again and
+// returns how many it decrypted
+func (s *Store) DecryptAll() (int, error) {
+	return s.recrypt(false)
+}
+
+// recrypt rewrites the copies whose encryption differs from encrypt. The
+// new copies get new names and the old ones are only removed once the
+// manifest points at the new ones, so an interrupted run leaves every
+// snapshot readable and can be repeated.
+func (s *Store) recrypt(encrypt bool) (int, error) {
+	if s.cipher == nil {
+		return 0, fmt.Errorf("backups have no cipher")
+	}
+	snapshots, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, snap := range snapshots {
+		changed := false
+		for i, f := range snap.Files {
+			if f.Encrypted == encrypt {
+				continue
+			}
+			data, err := s.read(snap, f)
+			if err != nil {
+				return count, err
+			}
+			if encrypt {
+				if data, err = s.cipher.Seal(f.Path, data); err != nil {
+					return count, fmt.Errorf("failed to encrypt the backup of %s: %w", f.Path, err)
+				}
+			}
+			name := copyName(f.Name, encrypt)
+			if err := fsutil.WriteFileAtomic(filepath.Join(s.dir, snap.ID, name), data, 0600); err != nil {
+				return count, fmt.Errorf("failed to rewrite the backup of %s: %w", f.Path, err)
+			}
+			snap.Files[i].Name = name
+			snap.Files[i].Encrypted = encrypt
+			changed = true
+			count++
+		}
+		if changed {
+			if err := s.writeManifest(snap); err != nil {
+				return count, err
+			}
+		}
+		// also drops what an interrupted run left behind
+		if err := s.removeUnlisted(snap); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// copyName names the copy of a file when it is encrypted or decrypted
+func copyName(name string, encrypted bool) string {
+	if encrypted {
+		return name + encryptedSuffix
+	}
+	if plain, ok := strings.CutSuffix(name, encryptedSuffix); ok {
+		return plain
+	}
+	return name + ".plain"
+}
+
+// removeUnlisted removes the files in a snapshot directory its manifest does
+// not list
+func (s *Store) removeUnlisted(snap *Snapshot) error {
+	listed := map[string]bool{manifestName: true}
+	for _, f := range snap.Files {
+		listed[f.Name] = true
+	}
+	entries, err := os.ReadDir(filepath.Join(s.dir, snap.ID))
+	if err != nil {
+		return fmt.Errorf("failed to read backup directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !listed[entry.Name()] {
+			if err := os.Remove(filepath.Join(s.dir, snap.ID, entry.Name())); err != nil {
+				return fmt.Errorf("failed to remove old backup copy: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/huzaifanur/ghpm/internal/backup"
+	"github.com/huzaifanur/ghpm/internal/config"
+)
+
+func (c *CLI) runBackup(args []string) error {
+	if len(args) == 0 {
+		return usageError("usage: ghpm %s", c.usage)
+	}
+
+	cfg := config.NewConfig()
+	store := cfg.BackupStore()
+	switch args[0] {
+	case "list":
+		if _, err := c.parseArgs(c.newFlagSet("backup list"), args[1:], 0); err != nil {
+			return err
+		}
+		return c.listBackups(store)
+	case "restore":
+		rest, err := c.parseArgs(c.newFlagSet("backup restore"), args[1:], 1)
+		if err != nil {
+			return err
+		}
+		// in vault mode the backups are encrypted with the vault key
+		if err := cfg.UnlockVault(c.promptMasterPassphrase); err != nil {
+			return err
+		}
+		return c.restoreBackup(store, rest[0])
+	default:
+		return usageError("unknown backup command %q (usage: ghpm %s)", args[0], c.usage)
+	}
+}
+
+func (c *CLI) listBackups(store *backup.Store) error {
+	snapshots, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	var text strings.Builder
+	if len(snapshots) == 0 {
+		text.WriteString("No backups found")
+	} else {
+		tw := tabwriter.NewWriter(&text, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tCREATED\tREASON\tFILES")
+		for _, snap := range snapshots {
+			var paths []string
+			for _, f := range snap.Files {
+				paths = append(paths, f.Path)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", snap.ID, snap.CreatedAt.Format("2006-01-02 15:04:05"),
+				snap.Reason, strings.Join(paths, ", "))
+		}
+		tw.Flush()
+	}
+
+	if snapshots == nil {
+		snapshots = []*backup.Snapshot{}
+	}
+	c.output(snapshots, text.String())
+	return nil
+}
+
+func (c *CLI) restoreBackup(store *backup.Store, id string) error {
+	if _, err := store.Get(id); err != nil {
+		return notFoundError(err)
+	}
+
+	snap, err := store.Restore(id)
+	if err != nil {
+		return err
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Restored backup %s:\n", snap.ID)
+	for _, f := range snap.Files {
+		fmt.Fprintf(&text, "  %s\n", f.Path)
+	}
+
+	c.output(snap, text.String())
+	return nil
+}
@@ -0,0 +1,472 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/huzaifanur/ghpm/internal/config"
+	"github.com/huzaifanur/ghpm/internal/git"
+	"github.com/huzaifanur/ghpm/pkg/version"
+	"golang.org/x/term"
+)
+
+// Exit codes returned by Run
+const (
+	ExitOK       = 0
+	ExitError    = 1
+	ExitUsage    = 2
+	ExitNotFound = 3
+	// failures of git and ssh, see failureExitCodes
+	ExitWrongAccount    = 4
+	ExitAuthFailed      = 5
+	ExitNetwork         = 6
+	ExitHostKeyMismatch = 7
+	ExitMissingTool     = 8
+	ExitConfigWrite     = 9
+)
+
+// failureExitCodes maps the kinds of git and SSH failures to exit codes
+var failureExitCodes = []struct {
+	kind error
+	code int
+}{
+	{git.ErrWrongAccount, ExitWrongAccount},
+	{git.ErrHostKeyMismatch, ExitHostKeyMismatch},
+	{git.ErrAuthFailed, ExitAuthFailed},
+	{git.ErrNetworkUnreachable, ExitNetwork},
+	{git.ErrTimeout, ExitNetwork},
+	{git.ErrGitNotFound, ExitMissingTool},
+	{git.ErrSSHNotFound, ExitMissingTool},
+	{git.ErrConfigWrite, ExitConfigWrite},
+}
+
+// exitError carries the exit code a failed command should terminate with
+type exitError struct {
+	code   int
+	err    error
+	silent bool
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func usageError(format string, args ...any) error {
+	return &exitError{code: ExitUsage, err: fmt.Errorf(format, args...)}
+}
+
+func notFoundError(err error) error {
+	return &exitError{code: ExitNotFound, err: err}
+}
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(c *CLI, args []string) error
+}
+
+var commands = []command{
+	{"list", "list", "List all profiles", (*CLI).runList},
+	{"show", "show [--randomart] NAME", "Show a profile", (*CLI).runShow},
+	{"switch", "switch [--for DURATION] NAME | switch -", "Switch git and SSH configuration to a profile (- for the previous one)", (*CLI).runSwitch},
+	{"revert", "revert", "End a temporary switch and restore the previous profile", (*CLI).runRevert},
+	{"history", "history [--limit N]", "Show recent profile switches", (*CLI).runHistory},
+	{"add", "add --name NAME --username USER --email EMAIL [--github-login LOGIN] (--private-key FILE --public-key FILE | --identity-file FILE | --generate-key [--passphrase]) [--certificate FILE] [--dir DIR]... [--remote PATTERN]...", "Add a profile", (*CLI).runAdd},
+	{"edit", "edit NAME [--name NEW] [--username USER] [--email EMAIL] [--github-login LOGIN] [--no-github-login] [--private-key FILE] [--public-key FILE] [--identity-file FILE] [--certificate FILE] [--no-certificate] [--dir DIR]... [--no-dirs] [--remote PATTERN]... [--no-remotes]", "Update a profile", (*CLI).runEdit},
+	{"key", "key generate [--passphrase] [--force] NAME", "Generate a new ed25519 key for a profile", (*CLI).runKey},
+	{"sync", "sync", "Rewrite profile SSH keys, host aliases and git includes", (*CLI).runSync},
+	{"delete", "delete NAME", "Delete a profile", (*CLI).runDelete},
+	{"import", "import FILE", "Import a profile from a JSON file", (*CLI).runImport},
+	{"export", "export NAME DIR", "Export a profile to a directory", (*CLI).runExport},
+	{"settings", "settings | settings set KEY VALUE", "Show or change settings", (*CLI).runSettings},
+	{"vault", "vault | vault enable | vault disable", "Show the vault state, or encrypt or decrypt stored private keys", (*CLI).runVault},
+	{"test", "test [--login LOGIN] [HOST]", "Test the SSH connection to GitHub, or to a GitHub Enterprise host, and check the account", (*CLI).runTest},
+	{"hostkey", "hostkey list | hostkey add HOST FILE | hostkey remove HOST", "List or pin the host keys SSH tests trust", (*CLI).runHostKey},
+	{"doctor", "doctor", "Check all profiles for problems, such as expired SSH certificates", (*CLI).runDoctor},
+	{"backup", "backup list | backup restore ID", "List or restore SSH key backups", (*CLI).runBackup},
+	{"exec", "exec --profile NAME -- COMMAND [ARGS...]", "Run a command under a profile's identity without switching", (*CLI).runExec},
+	{"version", "version", "Print the version", (*CLI).runVersion},
+}
+
+type CLI struct {
+	// ctx bounds the git and ssh commands of this invocation
+	ctx        context.Context
+	stdout     io.Writer
+	stderr     io.Writer
+	json       bool
+	usage      string
+	config     *config.Config
+	gitManager *git.Manager
+}
+
+// Run executes the command line described by args (without the program
+// name) and returns the process exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	// Ctrl-C cancels the running command, so a switch is rolled back; a
+	// second one ends ghpm at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	c := &CLI{
+		ctx:        ctx,
+		stdout:     stdout,
+		stderr:     stderr,
+		gitManager: git.NewManager(),
+	}
+	c.gitManager.SetPassphrasePrompt(c.promptPassphrase)
+
+	global := flag.NewFlagSet("ghpm", flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	global.BoolVar(&c.json, "json", false, "")
+	if err := global.Parse(args); err != nil {
+		return c.fail(usageError("%v", err))
+	}
+
+	args = global.Args()
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		c.printUsage(c.stdout)
+		return ExitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			c.usage = cmd.usage
+			if err := cmd.run(c, args[1:]); err != nil {
+				return c.fail(err)
+			}
+			return ExitOK
+		}
+	}
+
+	return c.fail(usageError("unknown command %q", args[0]))
+}
+
+func (c *CLI) printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: ghpm [--json] <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run without arguments to start the graphical interface.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+func (c *CLI) fail(err error) int {
+	code := ExitError
+	for _, f := range failureExitCodes {
+		if errors.Is(err, f.kind) {
+			code = f.code
+			break
+		}
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.code
+		if exitErr.silent {
+			return code
+		}
+	}
+	hint := git.Remediation(err)
+
+	if c.json {
+		out := map[string]any{"error": err.Error(), "code": code}
+		var switchErr *git.SwitchError
+		if errors.As(err, &switchErr) {
+			out["rolled_back"] = switchErr.RolledBack
+			var rollbackErrors []string
+			for _, rollbackErr := range switchErr.RollbackErrors {
+				rollbackErrors = append(rollbackErrors, rollbackErr.Error())
+			}
+			out["rollback_errors"] = rollbackErrors
+		}
+		var wrongAccountErr *git.WrongAccountError
+		if errors.As(err, &wrongAccountErr) {
+			out["login"] = wrongAccountErr.Login
+			out["expected_login"] = wrongAccountErr.Expected
+		}
+		if output := failureOutput(err); output != "" {
+			out["output"] = output
+		}
+		if hint != "" {
+			out["hint"] = hint
+		}
+		c.writeJSON(c.stderr, out)
+	} else {
+		fmt.Fprintf(c.stderr, "ghpm: %v\n", err)
+		if hint != "" {
+			fmt.Fprintf(c.stderr, "hint: %s\n", hint)
+		}
+		if code == ExitUsage {
+			fmt.Fprintln(c.stderr, "Run 'ghpm help' for usage.")
+		}
+	}
+
+	return code
+}
+
+// failureOutput is the raw output of the ssh or git command that failed
+func failureOutput(err error) string {
+	var sshErr *git.SSHError
+	var hostKeyErr *git.HostKeyMismatchError
+	var gitErr *git.GitError
+	switch {
+	case errors.As(err, &sshErr):
+		return strings.TrimSpace(sshErr.Output)
+	case errors.As(err, &hostKeyErr):
+		return strings.TrimSpace(hostKeyErr.Output)
+	case errors.As(err, &gitErr):
+		return strings.TrimSpace(gitErr.Output)
+	}
+	return ""
+}
+
+// warn reports a problem that did not make the command fail
+func (c *CLI) warn(err error) {
+	if c.json {
+		c.writeJSON(c.stderr, map[string]string{"warning": err.Error()})
+		return
+	}
+	fmt.Fprintf(c.stderr, "ghpm: warning: %v\n", err)
+}
+
+// warnUnusedSecret prints err as a warning when it only reports private keys
+// left in a secret backend after a successful change, and returns any other
+// error
+func (c *CLI) warnUnusedSecret(err error) error {
+	if config.IsUnusedSecret(err) {
+		c.warn(err)
+		return nil
+	}
+	return err
+}
+
+func (c *CLI) writeJSON(w io.Writer, v any) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// output prints v as JSON in --json mode, or the given text otherwise
+func (c *CLI) output(v any, text string) {
+	if c.json {
+		c.writeJSON(c.stdout, v)
+		return
+	}
+	fmt.Fprint(c.stdout, text)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		fmt.Fprintln(c.stdout)
+	}
+}
+
+// newFlagSet creates a flag set for a subcommand that also understands --json
+func (c *CLI) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&c.json, "json", c.json, "")
+	return fs
+}
+
+// parseArgs parses flags that may appear before or after positional
+// arguments and checks the number of positional arguments.
+func (c *CLI) parseArgs(fs *flag.FlagSet, args []string, positional int) ([]string, error) {
+	rest, err := c.parseFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != positional {
+		return nil, usageError("usage: ghpm %s", c.usage)
+	}
+	return rest, nil
+}
+
+// parseFlags parses flags that may appear before or after positional
+// arguments and returns the positional arguments
+func (c *CLI) parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, usageError("%v (usage: ghpm %s)", err, c.usage)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+	return rest, nil
+}
+
+// stringList is a flag that may be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// openConfig loads the profiles, unlocking the vault first, and applies the
+// settings
+func (c *CLI) openConfig() error {
+	if err := config.NewConfig().UnlockVault(c.promptMasterPassphrase); err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	c.config = cfg
+	c.gitManager.SetKnownHosts(c.config.KnownHosts())
+
+	settings, err := c.config.Settings()
+	if err != nil {
+		return err
+	}
+	config.ApplySettings(c.gitManager, settings)
+	return nil
+}
+
+// loadConfig loads the profiles, first reverting a temporary switch whose
+// time is up
+func (c *CLI) loadConfig() error {
+	if err := c.openConfig(); err != nil {
+		return err
+	}
+
+	restored, err := c.config.RevertExpiredTemporarySwitch(c.ctx, c.gitManager, config.SwitchOptions{Warn: c.warn})
+	if err != nil {
+		c.warn(fmt.Errorf("failed to end expired temporary switch: %w", err))
+	} else if restored != nil {
+		c.warn(fmt.Errorf("temporary switch expired; restored profile '%s'", restored.Name))
+	}
+	return nil
+}
+
+// promptPassphrase reads the passphrase of a profile's private key from the
+// terminal without echoing it
+func (c *CLI) promptPassphrase(profileName string, attempt int) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("the private key of profile '%s' is passphrase protected; run ghpm from a terminal to enter the passphrase", profileName)
+	}
+
+	if attempt > 1 {
+		fmt.Fprintln(c.stderr, "Incorrect passphrase, try again.")
+	}
+	return c.readPassword(fmt.Sprintf("Passphrase for the SSH key of profile '%s': ", profileName))
+}
+
+// promptMasterPassphrase reads the master passphrase of the vault from the
+// terminal
+func (c *CLI) promptMasterPassphrase(attempt int) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("%w; run ghpm from a terminal to enter the master passphrase", config.ErrVaultLocked)
+	}
+
+	if attempt > 1 {
+		fmt.Fprintln(c.stderr, "Incorrect master passphrase, try again.")
+	}
+	return c.readPassword("Master passphrase: ")
+}
+
+// readPassword prints prompt and reads a line from the terminal without
+// echoing it
+func (c *CLI) readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.GetState(fd)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	type result struct {
+		password []byte
+		err      error
+	}
+	done := make(chan result, 1)
+	fmt.Fprint(c.stderr, prompt)
+	go func() {
+		password, err := term.ReadPassword(fd)
+		done <- result{password, err}
+	}()
+
+	select {
+	case r := <-done:
+		fmt.Fprintln(c.stderr)
+		if r.err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", r.err)
+		}
+		return string(r.password), nil
+	case <-c.ctx.Done():
+		// Ctrl-C does not end the read, so turn echo back on here
+		term.Restore(fd, state)
+		fmt.Fprintln(c.stderr)
+		return "", c.ctx.Err()
+	}
+}
+
+// temporarySwitch returns the running temporary switch, if any
+func (c *CLI) temporarySwitch() *config.TemporarySwitch {
+	t, err := c.config.TemporarySwitch()
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+func (c *CLI) runExec(args []string) error {
+	fs := c.newFlagSet("exec")
+	name := fs.String("profile", "", "")
+	// flags end at the command so that its own flags are passed through
+	if err := fs.Parse(args); err != nil {
+		return usageError("%v (usage: ghpm %s)", err, c.usage)
+	}
+	command := fs.Args()
+	if *name == "" || len(command) == 0 {
+		return usageError("usage: ghpm %s", c.usage)
+	}
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	p, err := c.getProfile(*name)
+	if err != nil {
+		return err
+	}
+
+	code, err := c.gitManager.ExecWithProfile(p, command, os.Stdin, c.stdout, c.stderr)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return &exitError{code: code, err: fmt.Errorf("command exited with status %d", code), silent: true}
+	}
+
+	return nil
+}
+
+func (c *CLI) runVersion(args []string) error {
+	if _, err := c.parseArgs(c.newFlagSet("version"), args, 0); err != nil {
+		return err
+	}
+	c.output(map[string]string{"version": version.Version}, "ghpm "+version.Version)
+	return nil
+}
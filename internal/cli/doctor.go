@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/huzaifanur/ghpm/internal/git"
+	"github.com/huzaifanur/ghpm/internal/profile"
+)
+
+// Results of a doctor check
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+type doctorFinding struct {
+	Profile string `json:"profile"`
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// doctorCheck inspects one aspect of a profile. It returns an empty status
+// when the check does not apply to the profile.
+type doctorCheck struct {
+	name string
+	run  func(c *CLI, p *profile.Profile, now time.Time) (status, message string)
+}
+
+var doctorChecks = []doctorCheck{
+	{"profile", checkProfileValid},
+	{"certificate", checkCertificate},
+	{"active key", checkActiveKey},
+	{"git config", checkGitConfig},
+}
+
+func (c *CLI) runDoctor(args []string) error {
+	if _, err := c.parseArgs(c.newFlagSet("doctor"), args, 0); err != nil {
+		return err
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	profiles := c.config.GetProfiles()
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+
+	now := time.Now()
+	findings := []doctorFinding{}
+	failed := 0
+	var text strings.Builder
+	tw := tabwriter.NewWriter(&text, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROFILE\tCHECK\tSTATUS\tDETAILS")
+	for _, p := range profiles {
+		for _, check := range doctorChecks {
+			status, message := check.run(c, p, now)
+			if status == "" {
+				continue
+			}
+			if status == checkFail {
+				failed++
+			}
+			findings = append(findings, doctorFinding{Profile: p.Name, Check: check.name, Status: status, Message: message})
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Name, check.name, strings.ToUpper(status), message)
+		}
+	}
+	tw.Flush()
+
+	if len(profiles) == 0 {
+		text.Reset()
+		text.WriteString("No profiles found")
+	}
+
+	c.output(findings, text.String())
+	if failed > 0 {
+		return &exitError{code: ExitError, err: fmt.Errorf("%d checks failed", failed), silent: true}
+	}
+	return nil
+}
+
+func checkProfileValid(c *CLI, p *profile.Profile, now time.Time) (string, string) {
+	if err := p.Validate(); err != nil {
+		return checkFail, err.Error()
+	}
+	return checkOK, ""
+}
+
+func checkCertificate(c *CLI, p *profile.Profile, now time.Time) (string, string) {
+	info, err := p.Certificate()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	if info == nil {
+		return "", ""
+	}
+
+	switch info.Status(now) {
+	case git.CertificateExpired, git.CertificateNotYetValid:
+		return checkFail, info.Warning(now)
+	case git.CertificateExpiringSoon:
+		return checkWarn, info.Warning(now)
+	default:
+		return checkOK, info.String()
+	}
+}
+
+// checkActiveKey compares the active profile's key with the one ssh uses
+func checkActiveKey(c *CLI, p *profile.Profile, now time.Time) (string, string) {
+	if !p.IsActive || !p.HasSSHKeys() {
+		return "", ""
+	}
+	if err := p.VerifyActiveKey(c.ctx, c.gitManager); err != nil {
+		return checkFail, err.Error()
+	}
+	fingerprint, err := p.Fingerprint()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	return checkOK, fingerprint.SHA256
+}
+
+// checkGitConfig compares the active profile's identity with the global git
+// config, and ghpm's reading of that file with git's own
+func checkGitConfig(c *CLI, p *profile.Profile, now time.Time) (string, string) {
+	if !p.IsActive {
+		return "", ""
+	}
+	username, email, err := c.gitManager.GetCurrentGitConfig()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	if username != p.GitUsername || email != p.GitEmail {
+		return checkFail, fmt.Sprintf("git uses %s <%s>, not the profile's %s <%s>", username, email, p.GitUsername, p.GitEmail)
+	}
+
+	err = c.gitManager.CompareGitConfigWithGit(c.ctx)
+	switch {
+	case errors.Is(err, git.ErrGitNotFound):
+		return checkWarn, "git is not installed, so its reading of the config was not compared"
+	case err != nil:
+		return checkFail, err.Error()
+	}
+	return checkOK, fmt.Sprintf("%s <%s>", username, email)
+}
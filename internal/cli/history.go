@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/huzaifanur/ghpm/internal/config"
+)
+
+func (c *CLI) runHistory(args []string) error {
+	fs := c.newFlagSet("history")
+	limit := fs.Int("limit", 20, "")
+	if _, err := c.parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if *limit < 0 {
+		return usageError("--limit cannot be negative")
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	records, err := c.config.SwitchHistory()
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && len(records) > *limit {
+		records = records[:*limit]
+	}
+
+	var text strings.Builder
+	if len(records) == 0 {
+		text.WriteString("No profile switches recorded")
+	} else {
+		tw := tabwriter.NewWriter(&text, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tSOURCE\tFROM\tTO")
+		for _, r := range records {
+			from := r.From
+			if from == "" {
+				from = "-"
+			}
+			to := r.To
+			if r.Undo {
+				to += " (undo)"
+			}
+			if r.Until != nil {
+				to += " (until " + r.Until.Local().Format("15:04") + ")"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Time.Local().Format("2006-01-02 15:04:05"), r.Source, from, to)
+		}
+		tw.Flush()
+	}
+
+	if records == nil {
+		records = []config.SwitchRecord{}
+	}
+	c.output(records, text.String())
+	return nil
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/huzaifanur/ghpm/internal/config"
+	"github.com/huzaifanur/ghpm/internal/git"
+	"golang.org/x/crypto/ssh"
+)
+
+type hostKeyView struct {
+	Host        string `json:"host"`
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	BuiltIn     bool   `json:"built_in"`
+}
+
+type testView struct {
+	Host          string `json:"host"`
+	OK            bool   `json:"ok"`
+	Login         string `json:"login"`
+	ExpectedLogin string `json:"expected_login,omitempty"`
+}
+
+func (c *CLI) runHostKey(args []string) error {
+	if len(args) == 0 {
+		return usageError("usage: ghpm %s", c.usage)
+	}
+
+	knownHosts := config.NewConfig().KnownHosts()
+	switch args[0] {
+	case "list":
+		if _, err := c.parseArgs(c.newFlagSet("hostkey list"), args[1:], 0); err != nil {
+			return err
+		}
+		return c.listHostKeys(knownHosts)
+	case "add":
+		rest, err := c.parseArgs(c.newFlagSet("hostkey add"), args[1:], 2)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(rest[1])
+		if err != nil {
+			return fmt.Errorf("failed to read host key: %w", err)
+		}
+		if err := knownHosts.PinHostKey(rest[0], string(data)); err != nil {
+			return err
+		}
+		return c.listHostKeys(knownHosts)
+	case "remove":
+		rest, err := c.parseArgs(c.newFlagSet("hostkey remove"), args[1:], 1)
+		if err != nil {
+			return err
+		}
+		removed, err := knownHosts.UnpinHostKeys(rest[0])
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			return notFoundError(fmt.Errorf("no host key is pinned for %s", rest[0]))
+		}
+		c.output(map[string]any{"host": rest[0], "removed": removed},
+			fmt.Sprintf("Removed %d pinned host key(s) of %s", removed, rest[0]))
+		return nil
+	default:
+		return usageError("unknown hostkey command %q (usage: ghpm %s)", args[0], c.usage)
+	}
+}
+
+func (c *CLI) listHostKeys(knownHosts *git.KnownHosts) error {
+	keys, err := knownHosts.PinnedHostKeys()
+	if err != nil {
+		return err
+	}
+
+	views := make([]hostKeyView, 0, len(keys))
+	var text strings.Builder
+	tw := tabwriter.NewWriter(&text, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tTYPE\tFINGERPRINT\tSOURCE")
+	for _, k := range keys {
+		view := hostKeyView{Host: k.Host, Type: k.Key.Type(), Fingerprint: ssh.FingerprintSHA256(k.Key), BuiltIn: k.BuiltIn}
+		views = append(views, view)
+		source := "pinned"
+		if k.BuiltIn {
+			source = "built in"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", view.Host, view.Type, view.Fingerprint, source)
+	}
+	tw.Flush()
+
+	c.output(views, text.String())
+	return nil
+}
+
+func (c *CLI) runTest(args []string) error {
+	fs := c.newFlagSet("test")
+	expectedLogin := fs.String("login", "", "")
+	rest, err := c.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 1 {
+		return usageError("usage: ghpm %s", c.usage)
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	host := git.GitHubHost
+	if len(rest) == 1 {
+		host = strings.ToLower(rest[0])
+	}
+
+	var login string
+	if host == git.GitHubHost {
+		// github.com uses the active profile's key, so it should be its account
+		if active := c.config.GetActiveProfile(); active != nil && *expectedLogin == "" {
+			*expectedLogin = active.GitHubLogin
+		}
+		login, err = c.gitManager.TestSSHConnection(c.ctx, *expectedLogin)
+	} else {
+		login, err = c.gitManager.TestSSHHost(c.ctx, host, *expectedLogin)
+	}
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("SSH connection to %s works, authenticated as '%s'", host, login)
+	if *expectedLogin != "" {
+		text += " as expected"
+	}
+	c.output(testView{Host: host, OK: true, Login: login, ExpectedLogin: *expectedLogin}, text)
+	return nil
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/huzaifanur/ghpm/internal/profile"
+)
+
+func (c *CLI) runKey(args []string) error {
+	if len(args) == 0 || args[0] != "generate" {
+		return usageError("usage: ghpm %s", c.usage)
+	}
+
+	fs := c.newFlagSet("key generate")
+	withPassphrase := fs.Bool("passphrase", false, "")
+	force := fs.Bool("force", false, "")
+	rest, err := c.parseArgs(fs, args[1:], 1)
+	if err != nil {
+		return err
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	existing, err := c.getProfile(rest[0])
+	if err != nil {
+		return err
+	}
+	if existing.HasSSHKeys() && !*force {
+		return usageError("profile '%s' already has an SSH key; use --force to replace it", existing.Name)
+	}
+
+	p := *existing
+	if err := c.generateKey(&p, *withPassphrase); err != nil {
+		return err
+	}
+
+	if err := c.warnUnusedSecret(c.config.UpdateProfile(existing.Name, &p)); err != nil {
+		return err
+	}
+
+	if err := c.sync(); err != nil {
+		return err
+	}
+
+	c.outputPublicKey(&p, fmt.Sprintf("Generated a new ed25519 key for profile '%s'", p.Name))
+	return nil
+}
+
+// generateKey gives p a new key pair, asking for its passphrase first if
+// withPassphrase is set
+func (c *CLI) generateKey(p *profile.Profile, withPassphrase bool) error {
+	var passphrase string
+	if withPassphrase {
+		var err error
+		passphrase, err = c.newPassphrase("key passphrase")
+		if err != nil {
+			return err
+		}
+	}
+	return p.GenerateSSHKeys(passphrase)
+}
+
+// outputPublicKey reports a generated key with the public key to add to
+// GitHub
+func (c *CLI) outputPublicKey(p *profile.Profile, message string) {
+	view := newProfileView(p)
+	view.SSHPublicKey = strings.TrimSpace(p.SSHPublicKey)
+
+	text := fmt.Sprintf("%s\nAdd this public key to the GitHub account (Settings > SSH and GPG keys):\n\n%s",
+		message, view.SSHPublicKey)
+	c.output(view, text)
+}
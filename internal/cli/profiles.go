@@ -0,0 +1,647 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/huzaifanur/ghpm/internal/config"
+	"github.com/huzaifanur/ghpm/internal/git"
+	"github.com/huzaifanur/ghpm/internal/profile"
+)
+
+// profileView is the public representation of a profile; it never includes
+// the private key.
+type profileView struct {
+	Name         string   `json:"name"`
+	GitUsername  string   `json:"git_username"`
+	GitEmail     string   `json:"git_email"`
+	GitHubLogin  string   `json:"github_login,omitempty"`
+	IsActive     bool     `json:"is_active"`
+	HasSSHKeys   bool     `json:"has_ssh_keys"`
+	KeyEncrypted bool     `json:"key_encrypted"`
+	CreatedFrom  string   `json:"created_from"`
+	Directories  []string `json:"directories,omitempty"`
+	RemoteURLs   []string `json:"remote_urls,omitempty"`
+	SSHPublicKey string   `json:"ssh_public_key,omitempty"`
+	IdentityFile string   `json:"identity_file,omitempty"`
+	KeyType      string   `json:"key_type,omitempty"`
+
+	Fingerprint *fingerprintView `json:"fingerprint,omitempty"`
+	Certificate *certificateView `json:"certificate,omitempty"`
+	// KeyWarning is set when ssh uses another key than the active profile's
+	KeyWarning string `json:"key_warning,omitempty"`
+}
+
+// fingerprintView holds the fingerprints of a profile's public key
+type fingerprintView struct {
+	SHA256    string `json:"sha256"`
+	MD5       string `json:"md5"`
+	Randomart string `json:"randomart,omitempty"`
+}
+
+// certificateView is the public representation of a profile's SSH
+// certificate
+type certificateView struct {
+	KeyID       string     `json:"key_id"`
+	Serial      uint64     `json:"serial"`
+	Principals  []string   `json:"principals"`
+	ValidAfter  time.Time  `json:"valid_after"`
+	ValidBefore *time.Time `json:"valid_before,omitempty"`
+	Warning     string     `json:"warning,omitempty"`
+}
+
+func newCertificateView(info *git.CertificateInfo, now time.Time) *certificateView {
+	view := &certificateView{
+		KeyID:      info.KeyID,
+		Serial:     info.Serial,
+		Principals: info.Principals,
+		ValidAfter: info.ValidAfter,
+		Warning:    info.Warning(now),
+	}
+	if view.Principals == nil {
+		view.Principals = []string{}
+	}
+	if !info.ValidBefore.IsZero() {
+		view.ValidBefore = &info.ValidBefore
+	}
+	return view
+}
+
+func newProfileView(p *profile.Profile) profileView {
+	view := profileView{
+		Name:         p.Name,
+		GitUsername:  p.GitUsername,
+		GitEmail:     p.GitEmail,
+		GitHubLogin:  p.GitHubLogin,
+		IsActive:     p.IsActive,
+		HasSSHKeys:   p.HasSSHKeys(),
+		KeyEncrypted: p.HasEncryptedKey(),
+		CreatedFrom:  p.CreatedFrom,
+		Directories:  p.Directories,
+		RemoteURLs:   p.RemoteURLs,
+		IdentityFile: p.IdentityFile,
+	}
+	if fingerprint, err := p.Fingerprint(); err == nil && fingerprint != nil {
+		view.Fingerprint = &fingerprintView{SHA256: fingerprint.SHA256, MD5: fingerprint.MD5}
+	}
+	return view
+}
+
+func (c *CLI) getProfile(name string) (*profile.Profile, error) {
+	p, err := c.config.GetProfile(name)
+	if err != nil {
+		return nil, notFoundError(err)
+	}
+	return p, nil
+}
+
+func (c *CLI) runList(args []string) error {
+	if _, err := c.parseArgs(c.newFlagSet("list"), args, 0); err != nil {
+		return err
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	profiles := c.config.GetProfiles()
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+
+	views := make([]profileView, 0, len(profiles))
+	var text strings.Builder
+	tw := tabwriter.NewWriter(&text, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tUSERNAME\tEMAIL\tFINGERPRINT\tSTATUS")
+	for _, p := range profiles {
+		view := newProfileView(p)
+		views = append(views, view)
+		fingerprint := "-"
+		if view.Fingerprint != nil {
+			fingerprint = view.Fingerprint.SHA256
+		}
+		var status []string
+		if p.IsActive {
+			active := "ACTIVE"
+			if t := c.temporarySwitch(); t != nil && t.Profile == p.Name {
+				active += " until " + t.ExpiresAt.Local().Format("15:04")
+			}
+			status = append(status, active)
+		}
+		if p.HasEncryptedKey() {
+			status = append(status, "PASSPHRASE")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", p.Name, p.GitUsername, p.GitEmail, fingerprint, strings.Join(status, ", "))
+	}
+	tw.Flush()
+
+	if len(profiles) == 0 {
+		text.Reset()
+		text.WriteString("No profiles found")
+	}
+
+	c.output(views, text.String())
+	return nil
+}
+
+func (c *CLI) runShow(args []string) error {
+	fs := c.newFlagSet("show")
+	withRandomart := fs.Bool("randomart", false, "")
+	rest, err := c.parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	p, err := c.getProfile(rest[0])
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := p.GetSSHPublicKey()
+	if err != nil {
+		return err
+	}
+	view := newProfileView(p)
+	view.SSHPublicKey = strings.TrimSpace(publicKey)
+	if t, err := p.KeyType(); err == nil {
+		view.KeyType = t.Name
+	}
+	fingerprint, err := p.Fingerprint()
+	if err != nil {
+		return err
+	}
+	if fingerprint != nil && *withRandomart {
+		view.Fingerprint.Randomart = fingerprint.Randomart
+	}
+	certificate, err := p.Certificate()
+	if err != nil {
+		return err
+	}
+	if certificate != nil {
+		view.Certificate = newCertificateView(certificate, time.Now())
+	}
+	if p.IsActive {
+		if err := p.VerifyActiveKey(c.ctx, c.gitManager); err != nil {
+			view.KeyWarning = err.Error()
+		}
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Name:         %s\n", p.Name)
+	fmt.Fprintf(&text, "Git username: %s\n", p.GitUsername)
+	fmt.Fprintf(&text, "Git email:    %s\n", p.GitEmail)
+	if p.GitHubLogin != "" {
+		fmt.Fprintf(&text, "GitHub login: %s\n", p.GitHubLogin)
+	}
+	fmt.Fprintf(&text, "Active:       %t\n", p.IsActive)
+	fmt.Fprintf(&text, "Created from: %s\n", p.CreatedFrom)
+	for _, dir := range p.Directories {
+		fmt.Fprintf(&text, "Directory:    %s\n", dir)
+	}
+	for _, pattern := range p.RemoteURLs {
+		fmt.Fprintf(&text, "Remote URL:   %s\n", pattern)
+	}
+	if p.IsReference() {
+		fmt.Fprintf(&text, "Key file:     %s\n", p.IdentityFile)
+	}
+	if p.HasSSHKeys() {
+		if view.KeyType != "" {
+			fmt.Fprintf(&text, "Key type:     %s\n", view.KeyType)
+		}
+		fmt.Fprintf(&text, "Passphrase:   %t\n", view.KeyEncrypted)
+		fmt.Fprintf(&text, "Public key:   %s\n", view.SSHPublicKey)
+		if fingerprint != nil {
+			fmt.Fprintf(&text, "Fingerprint:  %s\n", fingerprint.SHA256)
+			fmt.Fprintf(&text, "              %s\n", fingerprint.MD5)
+			if *withRandomart {
+				fmt.Fprintf(&text, "%s\n", fingerprint.Randomart)
+			}
+		}
+		if view.KeyWarning != "" {
+			fmt.Fprintf(&text, "Warning:      %s\n", view.KeyWarning)
+		}
+		if certificate != nil {
+			fmt.Fprintf(&text, "Certificate:  %s\n", certificate)
+			if view.Certificate.Warning != "" {
+				fmt.Fprintf(&text, "Warning:      %s\n", view.Certificate.Warning)
+			}
+		}
+	} else {
+		fmt.Fprintf(&text, "Public key:   (none)\n")
+	}
+
+	c.output(view, text.String())
+	return nil
+}
+
+func (c *CLI) runSwitch(args []string) error {
+	fs := c.newFlagSet("switch")
+	duration := fs.Duration("for", 0, "")
+	rest, err := c.parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *duration < 0 {
+		return usageError("--for cannot be negative")
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	// "ghpm switch -" goes back to the profile active before the last switch
+	undo := rest[0] == "-"
+	var p *profile.Profile
+	if undo {
+		p, err = c.config.PreviousProfile()
+		if err != nil {
+			return notFoundError(err)
+		}
+	} else {
+		p, err = c.getProfile(rest[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := c.config.Switch(c.ctx, c.gitManager, p, c.switchOptions(undo, *duration)); err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Switched to profile '%s' (%s <%s>)", p.Name, p.GitUsername, p.GitEmail)
+	if *duration > 0 {
+		if t, err := c.config.TemporarySwitch(); err == nil && t != nil {
+			text += fmt.Sprintf("\nProfile '%s' is restored at %s; run 'ghpm revert' to end the switch earlier",
+				t.Previous, t.ExpiresAt.Local().Format("15:04"))
+		}
+	}
+	c.output(newProfileView(p), text)
+	return nil
+}
+
+func (c *CLI) runRevert(args []string) error {
+	if _, err := c.parseArgs(c.newFlagSet("revert"), args, 0); err != nil {
+		return err
+	}
+	// loaded without reverting an expired switch first, which would leave
+	// nothing to revert here
+	if err := c.openConfig(); err != nil {
+		return err
+	}
+
+	p, err := c.config.EndTemporarySwitch(c.ctx, c.gitManager, c.switchOptions(false, 0))
+	if err != nil {
+		return err
+	}
+
+	c.output(newProfileView(p), fmt.Sprintf("Restored profile '%s' (%s <%s>)", p.Name, p.GitUsername, p.GitEmail))
+	return nil
+}
+
+func (c *CLI) switchOptions(undo bool, duration time.Duration) config.SwitchOptions {
+	return config.SwitchOptions{
+		Source:   config.SwitchSourceCLI,
+		Undo:     undo,
+		Duration: duration,
+		Warn:     c.warn,
+	}
+}
+
+// loadKeys reads and validates the key files given on the command line
+func (c *CLI) loadKeys(p *profile.Profile, privateKeyPath, publicKeyPath string) error {
+	if p.IsReference() && (privateKeyPath != "" || publicKeyPath != "") {
+		// copied keys replace the key files used in place, so both are needed
+		if privateKeyPath == "" || publicKeyPath == "" {
+			return usageError("--private-key and --public-key must be given together to stop using %s", p.IdentityFile)
+		}
+		p.IdentityFile = ""
+	}
+
+	if err := p.LoadSSHKeysFromFiles(privateKeyPath, publicKeyPath); err != nil {
+		return err
+	}
+
+	if privateKeyPath != "" {
+		if err := c.gitManager.ValidateSSHKey(p.SSHPrivateKey, true); err != nil {
+			return fmt.Errorf("invalid private key: %w", err)
+		}
+	}
+	if publicKeyPath != "" {
+		if err := c.gitManager.ValidateSSHKey(p.SSHPublicKey, false); err != nil {
+			return fmt.Errorf("invalid public key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// loadCertificate reads the certificate given on the command line; it is
+// checked against the key by Validate
+func (c *CLI) loadCertificate(p *profile.Profile, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
+	if _, err := git.ParseSSHCertificate(string(data)); err != nil {
+		return fmt.Errorf("invalid certificate: %w", err)
+	}
+	p.SSHCertificate = string(data)
+	return nil
+}
+
+func (c *CLI) runAdd(args []string) error {
+	fs := c.newFlagSet("add")
+	name := fs.String("name", "", "")
+	username := fs.String("username", "", "")
+	email := fs.String("email", "", "")
+	githubLogin := fs.String("github-login", "", "")
+	privateKeyPath := fs.String("private-key", "", "")
+	publicKeyPath := fs.String("public-key", "", "")
+	identityFile := fs.String("identity-file", "", "")
+	generateKey := fs.Bool("generate-key", false, "")
+	withPassphrase := fs.Bool("passphrase", false, "")
+	certificatePath := fs.String("certificate", "", "")
+	var dirs, remotes stringList
+	fs.Var(&dirs, "dir", "")
+	fs.Var(&remotes, "remote", "")
+	if _, err := c.parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	if *name == "" || *username == "" || *email == "" {
+		return usageError("usage: ghpm %s", c.usage)
+	}
+	keyFiles := *privateKeyPath != "" || *publicKeyPath != ""
+	if *identityFile != "" && (keyFiles || *generateKey) {
+		return usageError("--identity-file cannot be combined with --private-key, --public-key or --generate-key")
+	}
+	if *generateKey && keyFiles {
+		return usageError("--generate-key cannot be combined with --private-key or --public-key")
+	}
+	if *withPassphrase && !*generateKey {
+		return usageError("--passphrase is only used with --generate-key")
+	}
+	if *identityFile == "" && !*generateKey && (*privateKeyPath == "" || *publicKeyPath == "") {
+		return usageError("usage: ghpm %s", c.usage)
+	}
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	p := &profile.Profile{
+		Name:        *name,
+		GitUsername: *username,
+		GitEmail:    *email,
+		GitHubLogin: *githubLogin,
+		CreatedFrom: "manual",
+		Directories: dirs,
+		RemoteURLs:  remotes,
+	}
+
+	switch {
+	case *identityFile != "":
+		if err := p.UseKeyFile(*identityFile); err != nil {
+			return fmt.Errorf("invalid key file: %w", err)
+		}
+	case *generateKey:
+		if err := c.generateKey(p, *withPassphrase); err != nil {
+			return err
+		}
+	default:
+		if err := c.loadKeys(p, *privateKeyPath, *publicKeyPath); err != nil {
+			return err
+		}
+	}
+	if *certificatePath != "" {
+		if err := c.loadCertificate(p, *certificatePath); err != nil {
+			return err
+		}
+	}
+
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.config.AddProfile(p); err != nil {
+		return err
+	}
+
+	if err := c.sync(); err != nil {
+		return err
+	}
+
+	if *generateKey {
+		c.outputPublicKey(p, fmt.Sprintf("Added profile '%s' with a new ed25519 key", p.Name))
+		return nil
+	}
+	c.output(newProfileView(p), fmt.Sprintf("Added profile '%s'", p.Name))
+	return nil
+}
+
+func (c *CLI) runEdit(args []string) error {
+	fs := c.newFlagSet("edit")
+	name := fs.String("name", "", "")
+	username := fs.String("username", "", "")
+	email := fs.String("email", "", "")
+	githubLogin := fs.String("github-login", "", "")
+	noGitHubLogin := fs.Bool("no-github-login", false, "")
+	privateKeyPath := fs.String("private-key", "", "")
+	publicKeyPath := fs.String("public-key", "", "")
+	identityFile := fs.String("identity-file", "", "")
+	certificatePath := fs.String("certificate", "", "")
+	noCertificate := fs.Bool("no-certificate", false, "")
+	var dirs, remotes stringList
+	fs.Var(&dirs, "dir", "")
+	fs.Var(&remotes, "remote", "")
+	noDirs := fs.Bool("no-dirs", false, "")
+	noRemotes := fs.Bool("no-remotes", false, "")
+	rest, err := c.parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *identityFile != "" && (*privateKeyPath != "" || *publicKeyPath != "") {
+		return usageError("--identity-file cannot be combined with --private-key or --public-key")
+	}
+	if *certificatePath != "" && *noCertificate {
+		return usageError("--certificate cannot be combined with --no-certificate")
+	}
+	if *githubLogin != "" && *noGitHubLogin {
+		return usageError("--github-login cannot be combined with --no-github-login")
+	}
+
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	existing, err := c.getProfile(rest[0])
+	if err != nil {
+		return err
+	}
+
+	p := *existing
+	if *name != "" {
+		p.Name = *name
+	}
+	if *username != "" {
+		p.GitUsername = *username
+	}
+	if *email != "" {
+		p.GitEmail = *email
+	}
+	if *noGitHubLogin {
+		p.GitHubLogin = ""
+	}
+	if *githubLogin != "" {
+		p.GitHubLogin = *githubLogin
+	}
+	if *noDirs {
+		p.Directories = nil
+	}
+	if len(dirs) > 0 {
+		p.Directories = dirs
+	}
+	if *noRemotes {
+		p.RemoteURLs = nil
+	}
+	if len(remotes) > 0 {
+		p.RemoteURLs = remotes
+	}
+
+	if *identityFile != "" {
+		if err := p.UseKeyFile(*identityFile); err != nil {
+			return fmt.Errorf("invalid key file: %w", err)
+		}
+	} else if err := c.loadKeys(&p, *privateKeyPath, *publicKeyPath); err != nil {
+		return err
+	}
+	if *noCertificate {
+		p.SSHCertificate = ""
+	}
+	if *certificatePath != "" {
+		if err := c.loadCertificate(&p, *certificatePath); err != nil {
+			return err
+		}
+	}
+
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.warnUnusedSecret(c.config.UpdateProfile(existing.Name, &p)); err != nil {
+		return err
+	}
+
+	if err := c.sync(); err != nil {
+		return err
+	}
+
+	c.output(newProfileView(&p), fmt.Sprintf("Updated profile '%s'", p.Name))
+	return nil
+}
+
+func (c *CLI) runDelete(args []string) error {
+	rest, err := c.parseArgs(c.newFlagSet("delete"), args, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	p, err := c.getProfile(rest[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.warnUnusedSecret(c.config.DeleteProfile(p.Name)); err != nil {
+		return err
+	}
+
+	if err := c.sync(); err != nil {
+		return err
+	}
+
+	c.output(map[string]string{"deleted": p.Name}, fmt.Sprintf("Deleted profile '%s'", p.Name))
+	return nil
+}
+
+func (c *CLI) runImport(args []string) error {
+	rest, err := c.parseArgs(c.newFlagSet("import"), args, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	p, err := c.config.ImportProfile(rest[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.sync(); err != nil {
+		return err
+	}
+
+	c.output(newProfileView(p), fmt.Sprintf("Imported profile '%s'", p.Name))
+	return nil
+}
+
+func (c *CLI) runExport(args []string) error {
+	rest, err := c.parseArgs(c.newFlagSet("export"), args, 2)
+	if err != nil {
+		return err
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	p, err := c.getProfile(rest[0])
+	if err != nil {
+		return err
+	}
+
+	exportDir, err := filepath.Abs(rest[1])
+	if err != nil {
+		return err
+	}
+
+	if err := c.config.ExportProfile(p.Name, exportDir); err != nil {
+		return fmt.Errorf("failed to export profile: %w", err)
+	}
+
+	exportPath := config.ExportFilePath(exportDir, p.Name)
+	c.output(map[string]string{"exported": p.Name, "path": exportPath},
+		fmt.Sprintf("Profile '%s' exported to %s", p.Name, exportPath))
+	return nil
+}
+
+func (c *CLI) sync() error {
+	if err := c.config.Sync(c.gitManager); err != nil {
+		return fmt.Errorf("failed to sync profiles to the system: %w", err)
+	}
+	return nil
+}
+
+func (c *CLI) runSync(args []string) error {
+	if _, err := c.parseArgs(c.newFlagSet("sync"), args, 0); err != nil {
+		return err
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	if err := c.sync(); err != nil {
+		return err
+	}
+
+	c.output(map[string]bool{"synced": true}, "SSH keys, host aliases and git includes are up to date")
+	return nil
+}
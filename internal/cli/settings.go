@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/huzaifanur/ghpm/internal/config"
+)
+
+func (c *CLI) runSettings(args []string) error {
+	if len(args) > 0 && args[0] == "set" {
+		rest, err := c.parseArgs(c.newFlagSet("settings set"), args[1:], 2)
+		if err != nil {
+			return err
+		}
+		return c.setSetting(rest[0], rest[1])
+	}
+
+	if _, err := c.parseArgs(c.newFlagSet("settings"), args, 0); err != nil {
+		return err
+	}
+	if err := c.openConfig(); err != nil {
+		return err
+	}
+
+	settings, err := c.config.Settings()
+	if err != nil {
+		return err
+	}
+	return c.printSettings(settings)
+}
+
+func (c *CLI) setSetting(key, value string) error {
+	if err := c.openConfig(); err != nil {
+		return err
+	}
+
+	settings, err := c.config.Settings()
+	if err != nil {
+		return err
+	}
+	previousStrategy := settings.SwitchStrategy
+	if err := settings.Set(key, value); err != nil {
+		return usageError("%v", err)
+	}
+	if err := c.config.SaveSettings(settings); err != nil {
+		return err
+	}
+
+	// key files and ssh-agent must match the new strategy right away
+	if settings.SwitchStrategy != previousStrategy {
+		config.ApplySettings(c.gitManager, settings)
+		if err := c.config.Reapply(c.ctx, c.gitManager); err != nil {
+			return fmt.Errorf("settings saved, but applying them failed: %w", err)
+		}
+	}
+
+	// also when unchanged, so a move that failed halfway can be finished
+	if key == config.SettingSecretBackend {
+		moved, err := c.config.MoveSecrets(settings.SecretBackend)
+		if err = c.warnUnusedSecret(err); err != nil {
+			return fmt.Errorf("settings saved, but moving private keys failed: %w", err)
+		}
+		if len(moved) > 0 && !c.json {
+			fmt.Fprintf(c.stderr, "Moved the private keys of: %s\n", strings.Join(moved, ", "))
+		}
+	}
+
+	return c.printSettings(settings)
+}
+
+func (c *CLI) printSettings(settings *config.Settings) error {
+	values := make(map[string]string)
+	var text strings.Builder
+	for _, key := range config.SettingKeys() {
+		value, err := settings.Get(key)
+		if err != nil {
+			return err
+		}
+		values[key] = value
+		fmt.Fprintf(&text, "%s = %s\n", key, value)
+	}
+
+	c.output(values, text.String())
+	return nil
+}
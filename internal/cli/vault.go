@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/huzaifanur/ghpm/internal/config"
+	"golang.org/x/term"
+)
+
+type vaultView struct {
+	Enabled   bool     `json:"enabled"`
+	Plaintext []string `json:"plaintext_profiles"`
+}
+
+func (c *CLI) runVault(args []string) error {
+	if len(args) > 0 && (args[0] == "enable" || args[0] == "disable") {
+		if _, err := c.parseArgs(c.newFlagSet("vault "+args[0]), args[1:], 0); err != nil {
+			return err
+		}
+		if args[0] == "enable" {
+			return c.enableVault()
+		}
+		return c.disableVault()
+	}
+
+	if _, err := c.parseArgs(c.newFlagSet("vault"), args, 0); err != nil {
+		return err
+	}
+
+	// the state is read without unlocking the vault
+	cfg := config.NewConfig()
+	plaintext, err := cfg.PlaintextProfiles()
+	if err != nil {
+		return err
+	}
+	view := vaultView{Enabled: cfg.VaultEnabled(), Plaintext: plaintext}
+	if view.Plaintext == nil {
+		view.Plaintext = []string{}
+	}
+
+	var text strings.Builder
+	if view.Enabled {
+		fmt.Fprintln(&text, "Vault:      enabled")
+	} else {
+		fmt.Fprintln(&text, "Vault:      disabled")
+	}
+	if len(plaintext) > 0 {
+		fmt.Fprintf(&text, "Plaintext:  %s\n", strings.Join(plaintext, ", "))
+		fmt.Fprintln(&text, "Run 'ghpm vault enable' to encrypt their private keys.")
+	}
+	c.output(view, text.String())
+	return nil
+}
+
+// enableVault sets a master passphrase and encrypts the stored private keys.
+// If the vault is already enabled it encrypts the profiles still stored in
+// plaintext.
+func (c *CLI) enableVault() error {
+	if err := c.openConfig(); err != nil {
+		return err
+	}
+
+	var converted []string
+	var err error
+	if c.config.VaultEnabled() {
+		converted, err = c.config.EncryptProfiles()
+	} else {
+		var passphrase string
+		passphrase, err = c.newPassphrase("master passphrase")
+		if err != nil {
+			return err
+		}
+		converted, err = c.config.EnableVault(passphrase)
+	}
+	if err != nil {
+		return err
+	}
+
+	text := "All stored private keys are encrypted."
+	if len(converted) > 0 {
+		text = fmt.Sprintf("Encrypted the private keys of: %s", strings.Join(converted, ", "))
+	}
+	if converted == nil {
+		converted = []string{}
+	}
+	c.output(map[string]any{"enabled": true, "encrypted": converted}, text)
+	return nil
+}
+
+func (c *CLI) disableVault() error {
+	if err := c.openConfig(); err != nil {
+		return err
+	}
+	if err := c.config.DisableVault(); err != nil {
+		return err
+	}
+
+	c.output(map[string]any{"enabled": false}, "Vault disabled; private keys are stored in plaintext again.")
+	return nil
+}
+
+// newPassphrase asks for a new passphrase, e.g. "master passphrase", twice
+func (c *CLI) newPassphrase(what string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("run ghpm from a terminal to set the %s", what)
+	}
+
+	passphrase, err := c.readPassword(fmt.Sprintf("New %s: ", what))
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("%s cannot be empty", what)
+	}
+	confirm, err := c.readPassword(fmt.Sprintf("Repeat %s: ", what))
+	if err != nil {
+		return "", err
+	}
+	if confirm != passphrase {
+		return "", fmt.Errorf("the passphrases do not match")
+	}
+	return passphrase, nil
+}
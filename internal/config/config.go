@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,12 +10,17 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/huzaifanur/ghpm/internal/backup"
+	"github.com/huzaifanur/ghpm/internal/fsutil"
+	"github.com/huzaifanur/ghpm/internal/git"
+	"github.com/huzaifanur/ghpm/internal/keyfiles"
 	"github.com/huzaifanur/ghpm/internal/profile"
 )
 
 type Config struct {
 	profiles  sync.Map
 	configDir string
+	storage   *profile.Storage
 }
 
 func NewConfig(configDir ...string) *Config {
@@ -24,9 +30,28 @@ func NewConfig(configDir ...string) *Config {
 	} else {
 		c.configDir = GetConfigDir()
 	}
+
+	backups := backup.NewStore(filepath.Join(c.configDir, "backups"))
+	backups.SetCipher(vaultCipher{c})
+	c.storage = &profile.Storage{
+		Backups: backups,
+		// not ending in .json, so it is never loaded as a profile
+		KeyFiles:   keyfiles.NewManifest(filepath.Join(c.configDir, "ssh_files.jsonl"), backups),
+		SecretsDir: filepath.Join(c.configDir, "secrets"),
+	}
 	return c
 }
 
+// BackupStore holds the snapshots of the key files ghpm overwrote or removed
+func (c *Config) BackupStore() *backup.Store {
+	return c.storage.Backups
+}
+
+// KnownHosts is the known_hosts file SSH connection tests run against
+func (c *Config) KnownHosts() *git.KnownHosts {
+	return git.NewKnownHosts(filepath.Join(c.configDir, "known_hosts"))
+}
+
 var getConfigDirFunc = func() string {
 	return os.ExpandEnv("$HOME/.ghpm")
 }
@@ -68,7 +93,10 @@ func LoadConfig() (*Config, error) {
 	for _, file := range files {
 		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
 			profilePath := filepath.Join(config.configDir, file.Name())
-			p, err := loadProfileFromFile(profilePath)
+			p, err := config.loadProfileFromFile(profilePath)
+			if errors.Is(err, ErrVaultLocked) {
+				return nil, err
+			}
 			if err != nil {
 				continue
 			}
@@ -88,7 +116,9 @@ func LoadConfig() (*Config, error) {
 	return config, nil
 }
 
-func loadProfileFromFile(path string) (*profile.Profile, error) {
+// loadProfileFromFile reads a profile, decrypting its private key if it was
+// stored in vault mode
+func (c *Config) loadProfileFromFile(path string) (*profile.Profile, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read profile file: %w", err)
@@ -98,6 +128,10 @@ func loadProfileFromFile(path string) (*profile.Profile, error) {
 	if err := json.Unmarshal(data, &p); err != nil {
 		return nil, fmt.Errorf("failed to parse profile: %w", err)
 	}
+	p.SetStorage(c.storage)
+	if err := c.openProfile(&p); err != nil {
+		return nil, err
+	}
 
 	return &p, nil
 }
@@ -115,22 +149,71 @@ func (c *Config) AddProfile(p *profile.Profile) error {
 	if _, exists := c.profiles.Load(p.Name); exists {
 		return fmt.Errorf("profile with name '%s' already exists", p.Name)
 	}
+	p.SetStorage(c.storage)
 
-	if err := c.saveProfileToFile(p); err != nil {
+	if err := c.checkBindings(p, ""); err != nil {
+		return err
+	}
+
+	// a new profile never shares a stored key with the one it came from
+	if p.SSHPrivateKeyRef != "" {
+		if err := p.ResolvePrivateKey(); err != nil {
+			return err
+		}
+		p.SSHPrivateKeyRef = ""
+	}
+	if err := c.storeSecret(p); err != nil {
 		return err
 	}
 
+	if err := c.saveProfileToFile(p); err != nil {
+		return errors.Join(err, c.dropSecret(p.SSHPrivateKeyRef))
+	}
+
 	c.profiles.Store(p.Name, p)
 	return nil
 }
 
+// UpdateProfile replaces profile oldName with p. An *UnusedSecretError means
+// p was saved, but the key it replaced is still in the secret backend.
 func (c *Config) UpdateProfile(oldName string, p *profile.Profile) error {
+	p.SetStorage(c.storage)
 	// Preserve active flag from existing profile (including rename cases)
+	var oldRef string
+	var existing *profile.Profile
 	if existingVal, ok := c.profiles.Load(oldName); ok {
-		if existing, ok2 := existingVal.(*profile.Profile); ok2 {
+		if existing, ok = existingVal.(*profile.Profile); ok {
 			p.IsActive = existing.IsActive
+			oldRef = existing.SSHPrivateKeyRef
+			// a key that stays in its backend keeps what was recorded about it
+			if p.SSHPrivateKey == "" && p.SSHPrivateKeyRef != "" && p.SSHPrivateKeyRef == oldRef {
+				p.SSHKeyEncrypted = existing.SSHKeyEncrypted
+			}
 		}
 	}
+	if err := c.checkBindings(p, oldName); err != nil {
+		return err
+	}
+	// an unchanged key stays where it is stored instead of being stored anew
+	if sameStoredKey(existing, p) {
+		p.SSHPrivateKeyRef = oldRef
+		p.SSHKeyEncrypted = git.IsEncryptedPrivateKey(p.SSHPrivateKey)
+	} else if err := c.storeSecret(p); err != nil {
+		return err
+	}
+	if err := c.replaceProfile(oldName, p); err != nil {
+		if p.SSHPrivateKeyRef != oldRef {
+			err = errors.Join(err, c.dropSecret(p.SSHPrivateKeyRef))
+		}
+		return err
+	}
+	if p.SSHPrivateKeyRef != oldRef {
+		return unusedSecrets(c.dropSecret(oldRef))
+	}
+	return nil
+}
+
+func (c *Config) replaceProfile(oldName string, p *profile.Profile) error {
 	if oldName != p.Name {
 		if _, exists := c.profiles.Load(p.Name); exists {
 			return fmt.Errorf("profile with name '%s' already exists", p.Name)
@@ -155,6 +238,42 @@ func (c *Config) UpdateProfile(oldName string, p *profile.Profile) error {
 	return nil
 }
 
+// checkBindings rejects directories and remote URL patterns already bound to
+// another profile, and names that map to another profile's SSH key file
+func (c *Config) checkBindings(p *profile.Profile, oldName string) error {
+	var err error
+	c.profiles.Range(func(key, value any) bool {
+		other := value.(*profile.Profile)
+		if other.Name == oldName || other.Name == p.Name {
+			return true
+		}
+		if other.SSHKeyName() == p.SSHKeyName() {
+			err = fmt.Errorf("profile name '%s' is too similar to '%s' (both use SSH key %s)", p.Name, other.Name, p.SSHKeyName())
+			return false
+		}
+		for _, dir := range p.Directories {
+			for _, otherDir := range other.Directories {
+				if git.GitdirCondition(dir) == git.GitdirCondition(otherDir) {
+					err = fmt.Errorf("directory %s is already bound to profile '%s'", dir, other.Name)
+					return false
+				}
+			}
+		}
+		for _, pattern := range p.RemoteURLs {
+			for _, otherPattern := range other.RemoteURLs {
+				if git.RemoteURLCondition(pattern) == git.RemoteURLCondition(otherPattern) {
+					err = fmt.Errorf("remote URL pattern %s is already bound to profile '%s'", pattern, other.Name)
+					return false
+				}
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// DeleteProfile removes an inactive profile. An *UnusedSecretError means the
+// profile was deleted, but its key is still in the secret backend.
 func (c *Config) DeleteProfile(name string) error {
 	value, exists := c.profiles.Load(name)
 	if !exists {
@@ -170,9 +289,8 @@ func (c *Config) DeleteProfile(name string) error {
 	if err := os.Remove(profilePath); err != nil {
 		return fmt.Errorf("failed to remove profile file: %w", err)
 	}
-
 	c.profiles.Delete(name)
-	return nil
+	return unusedSecrets(c.dropSecret(p.SSHPrivateKeyRef))
 }
 
 func (c *Config) GetProfile(name string) (*profile.Profile, error) {
@@ -196,6 +314,8 @@ func (c *Config) GetActiveProfile() *profile.Profile {
 	return activeProfile
 }
 
+// SetActiveProfile marks name as the only active profile. If saving any
+// profile fails, every active flag is put back the way it was.
 func (c *Config) SetActiveProfile(name string) error {
 	value, exists := c.profiles.Load(name)
 	if !exists {
@@ -203,24 +323,61 @@ func (c *Config) SetActiveProfile(name string) error {
 	}
 
 	targetProfile := value.(*profile.Profile)
+	wasActive := targetProfile.IsActive
 
+	targetProfile.IsActive = true
+	if err := c.saveProfileToFile(targetProfile); err != nil {
+		targetProfile.IsActive = wasActive
+		return err
+	}
+
+	var deactivated []*profile.Profile
+	var saveErr error
 	c.profiles.Range(func(key, value any) bool {
 		p := value.(*profile.Profile)
-		if p.IsActive {
-			p.IsActive = false
-			if err := c.saveProfileToFile(p); err != nil {
-				fmt.Printf("Warning: failed to save profile %s: %v\n", p.Name, err)
-			}
+		if p == targetProfile || !p.IsActive {
+			return true
 		}
+		p.IsActive = false
+		if err := c.saveProfileToFile(p); err != nil {
+			p.IsActive = true
+			saveErr = fmt.Errorf("failed to deactivate profile '%s': %w", p.Name, err)
+			return false
+		}
+		deactivated = append(deactivated, p)
 		return true
 	})
 
-	targetProfile.IsActive = true
-	return c.saveProfileToFile(targetProfile)
+	if saveErr != nil {
+		for _, p := range deactivated {
+			p.IsActive = true
+			c.saveProfileToFile(p)
+		}
+		targetProfile.IsActive = wasActive
+		c.saveProfileToFile(targetProfile)
+		return saveErr
+	}
+
+	return nil
+}
+
+func (c *Config) profilePath(name string) string {
+	return filepath.Join(c.configDir, name+".json")
 }
 
+// saveProfileToFile stores a profile, encrypting its private key in vault
+// mode
 func (c *Config) saveProfileToFile(p *profile.Profile) error {
-	profilePath := filepath.Join(c.configDir, p.Name+".json")
+	stored, err := c.sealProfile(p)
+	if err != nil {
+		return err
+	}
+	return c.writeProfileFile(stored)
+}
+
+// writeProfileFile stores p as it is
+func (c *Config) writeProfileFile(p *profile.Profile) error {
+	profilePath := c.profilePath(p.Name)
 
 	data, err := json.MarshalIndent(p, "", "  ")
 	if err != nil {
@@ -228,30 +385,7 @@ func (c *Config) saveProfileToFile(p *profile.Profile) error {
 	}
 
 	// atomic write to avoid partial/corrupt files
-	dir := filepath.Dir(profilePath)
-	tmp, err := os.CreateTemp(dir, filepath.Base(profilePath)+".tmp")
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
-	}
-	tmpPath := tmp.Name()
-	defer func() {
-		tmp.Close()
-		os.Remove(tmpPath)
-	}()
-
-	if _, err := tmp.Write(data); err != nil {
-		return fmt.Errorf("failed writing temp file: %w", err)
-	}
-	if err := tmp.Chmod(0600); err != nil {
-		return fmt.Errorf("failed to set file permissions: %w", err)
-	}
-	if err := tmp.Sync(); err != nil {
-		return fmt.Errorf("failed to sync temp file: %w", err)
-	}
-	if err := tmp.Close(); err != nil {
-		return fmt.Errorf("failed to close temp file: %w", err)
-	}
-	if err := os.Rename(tmpPath, profilePath); err != nil {
+	if err := fsutil.WriteFileAtomic(profilePath, data, 0600); err != nil {
 		return fmt.Errorf("failed to replace profile file: %w", err)
 	}
 
@@ -276,8 +410,7 @@ func (c *Config) ExportProfile(name, exportDir string) error {
 		return fmt.Errorf("export path is not a directory")
 	}
 
-	safeName := sanitizeFilename(name)
-	exportPath := filepath.Join(exportDir, safeName+".json")
+	exportPath := ExportFilePath(exportDir, name)
 
 	if _, err := os.Stat(exportPath); err == nil {
 		return fmt.Errorf("export file already exists: %s", exportPath)
@@ -287,6 +420,13 @@ func (c *Config) ExportProfile(name, exportDir string) error {
 		return fmt.Errorf("invalid profile data: %w", err)
 	}
 
+	// the export carries the keys themselves; key file paths and secret
+	// references only work here
+	p, err := p.WithInlineKeys()
+	if err != nil {
+		return err
+	}
+
 	if p.HasSSHKeys() {
 		if strings.TrimSpace(p.SSHPrivateKey) == "" {
 			return fmt.Errorf("profile marked as having SSH keys but private key is empty")
@@ -301,40 +441,18 @@ func (c *Config) ExportProfile(name, exportDir string) error {
 		return fmt.Errorf("failed to marshal profile: %w", err)
 	}
 
-	tmpFile, err := os.CreateTemp(exportDir, safeName+".json.tmp")
-	if err != nil {
-		return fmt.Errorf("failed to create temporary export file: %w", err)
-	}
-
-	tmpPath := tmpFile.Name()
-	defer func() {
-		tmpFile.Close()
-		os.Remove(tmpPath)
-	}()
-
-	if _, err := tmpFile.Write(data); err != nil {
-		return fmt.Errorf("failed to write export data: %w", err)
-	}
-
-	if err := tmpFile.Chmod(0600); err != nil {
-		return fmt.Errorf("failed to set export file permissions: %w", err)
-	}
-
-	if err := tmpFile.Sync(); err != nil {
-		return fmt.Errorf("failed to sync export file: %w", err)
-	}
-
-	if err := tmpFile.Close(); err != nil {
-		return fmt.Errorf("failed to close export file: %w", err)
-	}
-
-	if err := os.Rename(tmpPath, exportPath); err != nil {
-		return fmt.Errorf("failed to finalize export: %w", err)
+	if err := fsutil.WriteFileAtomic(exportPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
 	}
 
 	return nil
 }
 
+// ExportFilePath returns the file ExportProfile writes for a profile name
+func ExportFilePath(exportDir, name string) string {
+	return filepath.Join(exportDir, sanitizeFilename(name)+".json")
+}
+
 func (c *Config) ImportProfile(filePath string) (*profile.Profile, error) {
 	if filePath == "" {
 		return nil, fmt.Errorf("import file path cannot be empty")
@@ -357,10 +475,12 @@ func (c *Config) ImportProfile(filePath string) (*profile.Profile, error) {
 		return nil, fmt.Errorf("import file must have .json extension")
 	}
 
-	p, err := loadProfileFromFile(filePath)
+	p, err := c.loadProfileFromFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to import profile: %w", err)
 	}
+	// secret references are only valid where they were written
+	p.SSHPrivateKeyRef = ""
 
 	if err := c.validateImportedProfile(p); err != nil {
 		return nil, fmt.Errorf("invalid imported profile: %w", err)
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/huzaifanur/ghpm/internal/fsutil"
+	"github.com/huzaifanur/ghpm/internal/profile"
+)
+
+// historyFileName holds one JSON record per line. It does not end in .json
+// so LoadConfig never mistakes it for a profile.
+const historyFileName = "history.jsonl"
+
+// maxHistoryRecords bounds the history file; older records are dropped
+const maxHistoryRecords = 500
+
+// Sources of a profile switch
+const (
+	SwitchSourceCLI = "cli"
+	SwitchSourceGUI = "gui"
+	// SwitchSourceTimer is the automatic revert of an expired temporary switch
+	SwitchSourceTimer = "timer"
+)
+
+// SwitchRecord is one entry of the switch history
+type SwitchRecord struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	From   string    `json:"from,omitempty"` // empty if no profile was active
+	To     string    `json:"to"`
+	Undo   bool      `json:"undo,omitempty"` // switch back to the previous profile
+	// Until is when a temporary switch ends
+	Until *time.Time `json:"until,omitempty"`
+}
+
+func (c *Config) historyPath() string {
+	return filepath.Join(c.configDir, historyFileName)
+}
+
+// RecordSwitch appends a switch to the history file
+func (c *Config) RecordSwitch(record SwitchRecord) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+
+	records, err := c.readHistory()
+	if err != nil {
+		return err
+	}
+	records = append(records, record)
+	if len(records) > maxHistoryRecords {
+		records = records[len(records)-maxHistoryRecords:]
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("failed to marshal switch history: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(c.configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(c.historyPath(), buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write switch history: %w", err)
+	}
+	return nil
+}
+
+// SwitchHistory returns the recorded switches, newest first
+func (c *Config) SwitchHistory() ([]SwitchRecord, error) {
+	records, err := c.readHistory()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
+
+// PreviousProfile returns the profile that was active before the last
+// switch, i.e. the one undoing that switch goes back to. Switching back is
+// itself recorded, so repeated undos toggle between two profiles.
+func (c *Config) PreviousProfile() (*profile.Profile, error) {
+	records, err := c.readHistory()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no profile switch recorded yet")
+	}
+
+	last := records[len(records)-1]
+	if last.From == "" {
+		return nil, fmt.Errorf("no profile was active before switching to '%s'", last.To)
+	}
+	return c.GetProfile(last.From)
+}
+
+func (c *Config) readHistory() ([]SwitchRecord, error) {
+	data, err := os.ReadFile(c.historyPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read switch history: %w", err)
+	}
+
+	var records []SwitchRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var r SwitchRecord
+		// skip damaged lines rather than losing the whole history
+		if err := json.Unmarshal(line, &r); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/huzaifanur/ghpm/internal/git"
+	"github.com/huzaifanur/ghpm/internal/profile"
+)
+
+// IncludesDir holds the ghpm-owned git include files
+func (c *Config) IncludesDir() string {
+	return filepath.Join(c.configDir, "includes")
+}
+
+// Sync brings the system in line with the stored profiles: the key pairs and
+// host aliases in ~/.ssh, and the git includes of bound profiles.
+// It is run after profiles were added, changed or removed.
+func (c *Config) Sync(gitManager *git.Manager) error {
+	if err := c.SyncSSHConfig(gitManager.SSHKeyStrategy()); err != nil {
+		return err
+	}
+	return c.SyncIncludes(gitManager)
+}
+
+// SyncSSHConfig writes the key files of the profiles returned by
+// sshKeyProfiles under their own names in ~/.ssh and rewrites the
+// ghpm-managed block of ~/.ssh/config with a github.com-<profile> alias for
+// each, plus github.com itself for the active profile. All other key files
+// ghpm wrote are retired.
+func (c *Config) SyncSSHConfig(strategy git.SSHKeyStrategy) error {
+	configPath := git.SSHConfigPath()
+	previous, err := git.ReadManagedSSHHosts(configPath)
+	if err != nil {
+		return err
+	}
+	if err := c.adoptListedKeyFiles(previous); err != nil {
+		return err
+	}
+
+	var hosts []git.SSHHost
+	if active := c.GetActiveProfile(); active != nil && active.HasSSHKeys() {
+		hosts = append(hosts, git.DefaultSSHHost(active.SSHHost(strategy)))
+	}
+
+	for _, p := range c.sshKeyProfiles() {
+		if err := p.WriteSSHKeyFiles(strategy); err != nil {
+			return fmt.Errorf("profile '%s': %w", p.Name, err)
+		}
+		hosts = append(hosts, p.SSHHost(strategy))
+	}
+
+	if err := git.WriteManagedSSHHosts(configPath, hosts); err != nil {
+		return fmt.Errorf("failed to update SSH config: %w", err)
+	}
+
+	_, err = c.RetireStaleKeyFiles(strategy)
+	return err
+}
+
+// sshKeyProfiles returns the profiles with keys that need them in ~/.ssh,
+// sorted by name: the active profile, which github.com uses, and profiles
+// bound to directories or remote URLs, whose git includes point ssh at their
+// key. The private keys of other profiles stay out of ~/.ssh.
+func (c *Config) sshKeyProfiles() []*profile.Profile {
+	var profiles []*profile.Profile
+	for _, p := range c.GetProfiles() {
+		if p.HasSSHKeys() && (p.IsActive || p.HasBindings()) {
+			profiles = append(profiles, p)
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+// RetireStaleKeyFiles removes the key files ghpm wrote that sshKeyProfiles
+// does not need, e.g. those of deleted or renamed profiles or of the profile
+// that was active before a switch, and with the agent strategy every private
+// key it wrote. Files changed since ghpm wrote them are left alone; removed
+// ones are backed up first.
+func (c *Config) RetireStaleKeyFiles(strategy git.SSHKeyStrategy) ([]string, error) {
+	keep := make(map[string]bool)
+	for _, p := range c.GetProfiles() {
+		if p.IsReference() {
+			// never ghpm's to remove, even if it once wrote them
+			keep[p.IdentityFile] = true
+			keep[p.IdentityFile+".pub"] = true
+			keep[p.IdentityFile+"-cert.pub"] = true
+		}
+	}
+	for _, p := range c.sshKeyProfiles() {
+		if !p.IsReference() {
+			keep[p.SSHKeyPath()+".pub"] = true
+			if p.SSHCertificate != "" {
+				keep[p.SSHCertificatePath()] = true
+			}
+			if p.KeyStrategy(strategy) != git.SSHKeyStrategyAgent {
+				keep[p.SSHKeyPath()] = true
+			}
+		}
+	}
+
+	removed, err := c.storage.KeyFiles.Retire(keep, "before retiring SSH keys no profile needs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to retire stale SSH keys: %w", err)
+	}
+	return removed, nil
+}
+
+// adoptListedKeyFiles records the ghpm_* key files named in the managed block
+// that the manifest does not know yet, i.e. ones written before ghpm kept a
+// manifest, so they are retired like any other
+func (c *Config) adoptListedKeyFiles(hosts []git.SSHHost) error {
+	manifest := c.storage.KeyFiles
+	entries, err := manifest.Entries()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		known[e.Path] = true
+	}
+
+	files := make(map[string][]byte)
+	for _, h := range hosts {
+		if !strings.HasPrefix(filepath.Base(h.IdentityFile), "ghpm_") {
+			continue
+		}
+		for _, path := range []string{h.IdentityFile, h.IdentityFile + ".pub"} {
+			if known[path] {
+				continue
+			}
+			if data, err := os.ReadFile(path); err == nil {
+				files[path] = data
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	return manifest.Record("", files)
+}
+
+// SyncIncludes writes an include file for every profile bound to directories
+// or remote URLs and makes the ghpm-owned includeIf entries of the global git
+// config point at them. Files and entries of profiles without bindings are
+// removed. Remote URL entries come last so they win over directory entries.
+func (c *Config) SyncIncludes(gitManager *git.Manager) error {
+	includesDir := c.IncludesDir()
+	if err := os.MkdirAll(includesDir, 0700); err != nil {
+		return fmt.Errorf("failed to create includes directory: %w", err)
+	}
+
+	profiles := c.GetProfiles()
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+
+	var includes, remoteIncludes []git.ConditionalInclude
+	keep := make(map[string]bool)
+	boundTo := make(map[string]string)
+	for _, p := range profiles {
+		if !p.HasBindings() {
+			continue
+		}
+
+		safeName := sanitizeFilename(p.Name)
+		includePath := filepath.Join(includesDir, safeName+".gitconfig")
+
+		// the key itself is written to ~/.ssh by SyncSSHConfig
+		var keyPath string
+		if p.HasSSHKeys() {
+			keyPath = p.SSHIdentityFile(gitManager.SSHKeyStrategy())
+		}
+
+		if err := gitManager.WriteIncludeFile(includePath, p.GitUsername, p.GitEmail, keyPath); err != nil {
+			return fmt.Errorf("profile '%s': %w", p.Name, err)
+		}
+		keep[includePath] = true
+
+		for _, dir := range p.Directories {
+			condition := git.GitdirCondition(dir)
+			if other, exists := boundTo[condition]; exists {
+				return fmt.Errorf("directory %s is bound to both '%s' and '%s'", dir, other, p.Name)
+			}
+			boundTo[condition] = p.Name
+			includes = append(includes, git.ConditionalInclude{
+				Condition: condition,
+				Path:      includePath,
+			})
+		}
+		for _, pattern := range p.RemoteURLs {
+			condition := git.RemoteURLCondition(pattern)
+			if other, exists := boundTo[condition]; exists {
+				return fmt.Errorf("remote URL pattern %s is bound to both '%s' and '%s'", pattern, other, p.Name)
+			}
+			boundTo[condition] = p.Name
+			remoteIncludes = append(remoteIncludes, git.ConditionalInclude{
+				Condition: condition,
+				Path:      includePath,
+			})
+		}
+	}
+	includes = append(includes, remoteIncludes...)
+
+	if err := gitManager.SyncConditionalIncludes(includesDir, includes); err != nil {
+		return err
+	}
+
+	// remove files of profiles that were deleted or lost their bindings
+	entries, err := os.ReadDir(includesDir)
+	if err != nil {
+		return fmt.Errorf("failed to read includes directory: %w", err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(includesDir, entry.Name())
+		if !entry.IsDir() && !keep[path] {
+			os.Remove(path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/huzaifanur/ghpm/internal/git"
+	"github.com/huzaifanur/ghpm/internal/profile"
+	"github.com/huzaifanur/ghpm/internal/secrets"
+)
+
+// storeSecret moves a private key given with p into the configured secret
+// backend, leaving only a reference in the profile file
+func (c *Config) storeSecret(p *profile.Profile) error {
+	if p.SSHPrivateKey == "" {
+		return nil
+	}
+	settings, err := c.Settings()
+	if err != nil {
+		return err
+	}
+	return c.storeSecretIn(settings.SecretBackend, p)
+}
+
+// sameStoredKey reports whether p holds the private key existing keeps in a
+// secret backend, loading it to compare if needed
+func sameStoredKey(existing, p *profile.Profile) bool {
+	if existing == nil || existing.SSHPrivateKeyRef == "" || p.SSHPrivateKey == "" {
+		return false
+	}
+	if err := existing.ResolvePrivateKey(); err != nil {
+		return false
+	}
+	return existing.SSHPrivateKey == p.SSHPrivateKey
+}
+
+// storeSecretIn stores the private key of p in the named backend under a new
+// id; the caller drops the secret p referred to before once the profile is
+// saved. Whether the key is passphrase protected is recorded in the profile,
+// which then no longer holds the key.
+func (c *Config) storeSecretIn(backendName string, p *profile.Profile) error {
+	p.SSHKeyEncrypted = git.IsEncryptedPrivateKey(p.SSHPrivateKey)
+	if backendName == SecretBackendProfile {
+		p.SSHPrivateKeyRef = ""
+		return nil
+	}
+	if err := c.checkSecretBackend(backendName); err != nil {
+		return err
+	}
+
+	backend, err := secrets.Open(backendName, c.storage.SecretsDir)
+	if err != nil {
+		return err
+	}
+	id, err := secrets.NewID()
+	if err != nil {
+		return err
+	}
+
+	label := fmt.Sprintf("ghpm SSH key of profile '%s'", p.Name)
+	if err := backend.Store(id, label, p.SSHPrivateKey); err != nil {
+		return fmt.Errorf("failed to store the private key of profile '%s': %w", p.Name, err)
+	}
+	p.SSHPrivateKeyRef = secrets.Ref(backendName, id)
+	return nil
+}
+
+// checkSecretBackend refuses the file backend in vault mode, as it would
+// store the keys the vault encrypts in plaintext
+func (c *Config) checkSecretBackend(backendName string) error {
+	if backendName == secrets.FileBackendName && c.VaultEnabled() {
+		return fmt.Errorf("the %q secret backend stores private keys unencrypted, so it cannot be used with the vault; use %q to keep them encrypted in the profile files",
+			secrets.FileBackendName, SecretBackendProfile)
+	}
+	return nil
+}
+
+// usesFileSecrets reports whether private keys are, or are to be, kept by
+// the file backend
+func (c *Config) usesFileSecrets() (bool, error) {
+	settings, err := c.Settings()
+	if err != nil {
+		return false, err
+	}
+	if settings.SecretBackend == secrets.FileBackendName {
+		return true, nil
+	}
+	for _, p := range c.GetProfiles() {
+		if backend, _, err := secrets.ParseRef(p.SSHPrivateKeyRef); err == nil && backend == secrets.FileBackendName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UnusedSecretError reports private keys no profile refers to any more that
+// could not be removed from their secret backend. The change that left them
+// unused was saved, so callers report it as a warning.
+type UnusedSecretError struct {
+	Errs []error
+}
+
+func (e *UnusedSecretError) Error() string {
+	return fmt.Sprintf("%v; the change was saved, but the key is still stored and should be removed by hand", errors.Join(e.Errs...))
+}
+
+func (e *UnusedSecretError) Unwrap() []error {
+	return e.Errs
+}
+
+// IsUnusedSecret reports whether err only warns about keys left in a secret
+// backend
+func IsUnusedSecret(err error) bool {
+	_, ok := err.(*UnusedSecretError)
+	return ok
+}
+
+// dropSecret removes a stored key no profile refers to any more
+func (c *Config) dropSecret(ref string) error {
+	if ref == "" {
+		return nil
+	}
+	if err := secrets.Delete(ref, c.storage.SecretsDir); err != nil {
+		return fmt.Errorf("failed to remove the unused private key %s: %w", ref, err)
+	}
+	return nil
+}
+
+// unusedSecrets wraps the errors of dropSecret on an otherwise successful
+// change, or returns nil if there are none
+func unusedSecrets(errs ...error) error {
+	var kept []error
+	for _, err := range errs {
+		if err != nil {
+			kept = append(kept, err)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return &UnusedSecretError{Errs: kept}
+}
+
+// MoveSecrets moves the private keys of all profiles into the named backend,
+// or back into the profile files for SecretBackendProfile, and returns the
+// names of the profiles it changed. Running it again after a failure
+// continues where it stopped. An *UnusedSecretError means all keys were
+// moved, but some could not be removed from their old backend.
+func (c *Config) MoveSecrets(backendName string) ([]string, error) {
+	var moved []string
+	var unused []error
+	for _, p := range c.GetProfiles() {
+		if !p.HasSSHKeys() || p.IsReference() {
+			continue
+		}
+
+		current := SecretBackendProfile
+		if p.SSHPrivateKeyRef != "" {
+			name, _, err := secrets.ParseRef(p.SSHPrivateKeyRef)
+			if err != nil {
+				return moved, errors.Join(fmt.Errorf("profile '%s': %w", p.Name, err), unusedSecrets(unused...))
+			}
+			current = name
+		}
+		if current == backendName {
+			continue
+		}
+
+		if err := p.ResolvePrivateKey(); err != nil {
+			return moved, errors.Join(err, unusedSecrets(unused...))
+		}
+		oldRef := p.SSHPrivateKeyRef
+		if err := c.storeSecretIn(backendName, p); err != nil {
+			return moved, errors.Join(err, unusedSecrets(unused...))
+		}
+		if err := c.saveProfileToFile(p); err != nil {
+			err = errors.Join(err, c.dropSecret(p.SSHPrivateKeyRef))
+			p.SSHPrivateKeyRef = oldRef
+			return moved, errors.Join(err, unusedSecrets(unused...))
+		}
+		unused = append(unused, c.dropSecret(oldRef))
+		moved = append(moved, p.Name)
+	}
+	return moved, unusedSecrets(unused...)
+}
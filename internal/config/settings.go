@@ -0,0 +1,169 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/huzaifanur/ghpm/internal/fsutil"
+	"github.com/huzaifanur/ghpm/internal/git"
+	"github.com/huzaifanur/ghpm/internal/secrets"
+)
+
+// settingsFileName holds the application settings as "key = value" lines
+const settingsFileName = "settings.conf"
+
+// Setting keys
+const (
+	SettingSwitchStrategy   = "switch_strategy"
+	SettingAgentKeyLifetime = "agent_key_lifetime"
+	SettingSecretBackend    = "secret_backend"
+)
+
+// SecretBackendProfile keeps private keys inside the profile files, where the
+// vault can encrypt them. The other secret_backend values are the names of
+// the secrets package backends.
+const SecretBackendProfile = "profile"
+
+// Settings are the user's preferences for how ghpm applies profiles
+type Settings struct {
+	// SwitchStrategy is how a switch hands the profile's key to ssh
+	SwitchStrategy git.SSHKeyStrategy
+	// AgentKeyLifetime limits how long ssh-agent keeps a key added by the
+	// agent strategy; zero keeps it until it is removed
+	AgentKeyLifetime time.Duration
+	// SecretBackend is where private keys of profiles are stored
+	SecretBackend string
+}
+
+// DefaultSettings are used for settings missing from the settings file
+func DefaultSettings() *Settings {
+	return &Settings{
+		SwitchStrategy: git.SSHKeyStrategyFiles,
+		SecretBackend:  SecretBackendProfile,
+	}
+}
+
+// SettingKeys lists the known settings in the order they are shown
+func SettingKeys() []string {
+	return []string{SettingSwitchStrategy, SettingAgentKeyLifetime, SettingSecretBackend}
+}
+
+// Get returns a setting as text
+func (s *Settings) Get(key string) (string, error) {
+	switch key {
+	case SettingSwitchStrategy:
+		return string(s.SwitchStrategy), nil
+	case SettingAgentKeyLifetime:
+		if s.AgentKeyLifetime == 0 {
+			return "0", nil
+		}
+		return s.AgentKeyLifetime.String(), nil
+	case SettingSecretBackend:
+		return s.SecretBackend, nil
+	default:
+		return "", fmt.Errorf("unknown setting %q", key)
+	}
+}
+
+// Set parses value into the setting key
+func (s *Settings) Set(key, value string) error {
+	value = strings.TrimSpace(value)
+	switch key {
+	case SettingSwitchStrategy:
+		strategy := git.SSHKeyStrategy(value)
+		if strategy != git.SSHKeyStrategyFiles && strategy != git.SSHKeyStrategyAgent {
+			return fmt.Errorf("%s must be %q or %q", key, git.SSHKeyStrategyFiles, git.SSHKeyStrategyAgent)
+		}
+		s.SwitchStrategy = strategy
+	case SettingAgentKeyLifetime:
+		if value == "" || value == "0" {
+			s.AgentKeyLifetime = 0
+			return nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Second {
+			return fmt.Errorf("%s must be a duration of at least 1s, e.g. 8h, or 0 for no limit", key)
+		}
+		s.AgentKeyLifetime = d
+	case SettingSecretBackend:
+		if value != SecretBackendProfile && value != secrets.FileBackendName && value != secrets.SecretServiceName {
+			return fmt.Errorf("%s must be %q, %q or %q", key, SecretBackendProfile, secrets.FileBackendName, secrets.SecretServiceName)
+		}
+		s.SecretBackend = value
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+func (c *Config) settingsPath() string {
+	return filepath.Join(c.configDir, settingsFileName)
+}
+
+// Settings loads the settings file; missing settings keep their defaults
+func (c *Config) Settings() (*Settings, error) {
+	s := DefaultSettings()
+
+	f, err := os.Open(c.settingsPath())
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(text, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected key = value", settingsFileName, line)
+		}
+		if err := s.Set(strings.TrimSpace(key), value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", settingsFileName, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read settings: %w", err)
+	}
+
+	return s, nil
+}
+
+// SaveSettings writes all settings to the settings file
+func (c *Config) SaveSettings(s *Settings) error {
+	if err := c.checkSecretBackend(s.SecretBackend); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("# ghpm settings\n")
+	for _, key := range SettingKeys() {
+		value, err := s.Get(key)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s = %s\n", key, value)
+	}
+
+	if err := os.MkdirAll(c.configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(c.settingsPath(), []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+	return nil
+}
+
+// ApplySettings configures gitManager the way the settings ask for
+func ApplySettings(gitManager *git.Manager, s *Settings) {
+	gitManager.SetSSHKeyStrategy(s.SwitchStrategy, s.AgentKeyLifetime)
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/huzaifanur/ghpm/internal/git"
+	"github.com/huzaifanur/ghpm/internal/profile"
+)
+
+// SwitchOptions controls how Config.Switch applies a profile
+type SwitchOptions struct {
+	Source string
+	// Undo marks a switch back to the previous profile
+	Undo bool
+	// Duration makes the switch temporary: the previous profile is restored
+	// once it has passed
+	Duration time.Duration
+	// Run runs fn wherever the config may be changed, e.g. on the UI thread.
+	// If nil, fn runs directly.
+	Run func(fn func())
+	// Warn receives problems that do not make the switch fail. If nil they
+	// are ignored.
+	Warn func(err error)
+}
+
+func (o SwitchOptions) run(fn func()) {
+	if o.Run != nil {
+		o.Run(fn)
+		return
+	}
+	fn()
+}
+
+func (o SwitchOptions) warn(err error) {
+	if o.Warn != nil {
+		o.Warn(err)
+	}
+}
+
+// Switch applies p through gitManager, marks it active and records the
+// switch in the history. A temporary switch is saved next to the profiles so
+// it is reverted even after a restart; any other switch ends a running
+// temporary switch. Cancelling ctx rolls the switch back; see
+// git.Manager.SwitchProfile.
+func (c *Config) Switch(ctx context.Context, gitManager *git.Manager, p *profile.Profile, opts SwitchOptions) error {
+	var from string
+	var running *TemporarySwitch
+	var err error
+	opts.run(func() {
+		if active := c.GetActiveProfile(); active != nil {
+			from = active.Name
+		}
+		running, err = c.TemporarySwitch()
+	})
+	if err != nil {
+		// a damaged record must not block switching; it is replaced below
+		opts.warn(err)
+	}
+
+	var temporary *TemporarySwitch
+	if opts.Duration > 0 {
+		if from == "" {
+			return fmt.Errorf("a temporary switch needs an active profile to return to")
+		}
+		if from == p.Name {
+			return fmt.Errorf("profile '%s' is already active", p.Name)
+		}
+		// stacking temporary switches still returns to the original profile
+		previous := from
+		if running != nil {
+			previous = running.Previous
+		}
+		now := time.Now()
+		temporary = &TemporarySwitch{
+			Profile:   p.Name,
+			Previous:  previous,
+			StartedAt: now,
+			ExpiresAt: now.Add(opts.Duration),
+		}
+	}
+
+	if err := gitManager.SwitchProfile(ctx, p, func() error {
+		var err error
+		opts.run(func() {
+			err = c.activate(p.Name, temporary, running)
+		})
+		return err
+	}); err != nil {
+		return err
+	}
+
+	record := SwitchRecord{
+		Source: opts.Source,
+		From:   from,
+		To:     p.Name,
+		Undo:   opts.Undo,
+	}
+	if temporary != nil {
+		record.Until = &temporary.ExpiresAt
+	}
+
+	opts.run(func() {
+		if err := c.RecordSwitch(record); err != nil {
+			opts.warn(err)
+		}
+		// drops the alias and key files of the previous profile unless its
+		// bindings still need them, and moves the bindings back after the
+		// identity the switch may have added to the global git config
+		if err := c.Sync(gitManager); err != nil {
+			opts.warn(err)
+		}
+	})
+	return nil
+}
+
+// EndTemporarySwitch restores the profile that was active before the running
+// temporary switch and returns it
+func (c *Config) EndTemporarySwitch(ctx context.Context, gitManager *git.Manager, opts SwitchOptions) (*profile.Profile, error) {
+	var running *TemporarySwitch
+	var previous *profile.Profile
+	var err error
+	opts.run(func() {
+		running, err = c.TemporarySwitch()
+		if err != nil || running == nil {
+			return
+		}
+		previous, err = c.GetProfile(running.Previous)
+		if err != nil {
+			// there is nothing left to go back to
+			c.clearTemporarySwitch()
+			err = fmt.Errorf("cannot restore profile '%s': %w", running.Previous, err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if running == nil {
+		return nil, fmt.Errorf("no temporary switch is running")
+	}
+
+	opts.Duration = 0
+	if err := c.Switch(ctx, gitManager, previous, opts); err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// activate marks name active and saves or ends the temporary switch. If
+// activation fails the temporary switch is put back the way it was.
+func (c *Config) activate(name string, temporary, running *TemporarySwitch) error {
+	var err error
+	switch {
+	case temporary != nil:
+		err = c.setTemporarySwitch(temporary)
+	case running != nil:
+		err = c.clearTemporarySwitch()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := c.SetActiveProfile(name); err != nil {
+		if running != nil {
+			c.setTemporarySwitch(running)
+		} else {
+			c.clearTemporarySwitch()
+		}
+		return err
+	}
+	return nil
+}
+
+// RevertExpiredTemporarySwitch ends the running temporary switch if its time
+// is up. It returns the restored profile, or nil if nothing was due.
+func (c *Config) RevertExpiredTemporarySwitch(ctx context.Context, gitManager *git.Manager, opts SwitchOptions) (*profile.Profile, error) {
+	var running *TemporarySwitch
+	var err error
+	opts.run(func() {
+		running, err = c.TemporarySwitch()
+	})
+	if err != nil || running == nil || !running.Expired(time.Now()) {
+		return nil, err
+	}
+
+	opts.Source = SwitchSourceTimer
+	return c.EndTemporarySwitch(ctx, gitManager, opts)
+}
+
+// Reapply applies the active profile again and syncs all profiles to the
+// system, e.g. after the switch strategy was changed
+func (c *Config) Reapply(ctx context.Context, gitManager *git.Manager) error {
+	if active := c.GetActiveProfile(); active != nil {
+		if err := gitManager.SwitchProfile(ctx, active, nil); err != nil {
+			return err
+		}
+	}
+	return c.Sync(gitManager)
+}
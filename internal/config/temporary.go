@@ -0,0 +1,74 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/huzaifanur/ghpm/internal/fsutil"
+)
+
+// temporarySwitchFileName holds the running temporary switch, if any. Like
+// the history it must not end in .json.
+const temporarySwitchFileName = "temporary_switch.state"
+
+// TemporarySwitch is a switch that is reverted to Previous at ExpiresAt
+type TemporarySwitch struct {
+	Profile   string    `json:"profile"`
+	Previous  string    `json:"previous"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Remaining returns how long the switch still lasts, never less than zero
+func (t *TemporarySwitch) Remaining(now time.Time) time.Duration {
+	if remaining := t.ExpiresAt.Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+func (t *TemporarySwitch) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+func (c *Config) temporarySwitchPath() string {
+	return filepath.Join(c.configDir, temporarySwitchFileName)
+}
+
+// TemporarySwitch returns the running temporary switch, or nil if there is none
+func (c *Config) TemporarySwitch() (*TemporarySwitch, error) {
+	data, err := os.ReadFile(c.temporarySwitchPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read temporary switch: %w", err)
+	}
+
+	var t TemporarySwitch
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse temporary switch: %w", err)
+	}
+	return &t, nil
+}
+
+func (c *Config) setTemporarySwitch(t *TemporarySwitch) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal temporary switch: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(c.temporarySwitchPath(), data, 0600); err != nil {
+		return fmt.Errorf("failed to save temporary switch: %w", err)
+	}
+	return nil
+}
+
+func (c *Config) clearTemporarySwitch() error {
+	if err := os.Remove(c.temporarySwitchPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear temporary switch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,436 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/huzaifanur/ghpm/internal/fsutil"
+	"github.com/huzaifanur/ghpm/internal/profile"
+	"github.com/huzaifanur/ghpm/internal/secrets"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// vaultFileName holds the key derivation parameters of the vault. Its
+// presence turns vault mode on. Like the history it must not end in .json.
+const vaultFileName = "vault.state"
+
+// vaultValuePrefix marks a profile field encrypted with the vault key
+const vaultValuePrefix = "ghpm-vault:v1:"
+
+// vaultCheckText is encrypted into the vault file so a wrong master
+// passphrase is recognised even when there are no profiles
+const vaultCheckText = "ghpm vault"
+
+// maxVaultAttempts is how often the master passphrase is asked for
+const maxVaultAttempts = 3
+
+// argon2id parameters for new vaults; stored vaults keep their own
+const (
+	vaultKDFTime    = 3
+	vaultKDFMemory  = 64 * 1024 // KiB
+	vaultKDFThreads = 4
+	vaultSaltSize   = 16
+)
+
+// ErrVaultLocked is returned when a profile is read or written in vault mode
+// before the vault was unlocked
+var ErrVaultLocked = errors.New("the profile vault is locked")
+
+// errIncorrectMasterPassphrase is returned by a failed unlock attempt
+var errIncorrectMasterPassphrase = errors.New("incorrect master passphrase")
+
+// VaultPrompt asks for the master passphrase; attempt starts at 1 and grows
+// after each incorrect passphrase
+type VaultPrompt func(attempt int) (string, error)
+
+// vaultFile is the content of the vault file
+type vaultFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Check   string `json:"check"`
+}
+
+// vaultKeys caches the unlocked vault key per config directory, so the
+// master passphrase is asked for once per process
+var vaultKeys = struct {
+	sync.Mutex
+	keys map[string][]byte
+}{keys: map[string][]byte{}}
+
+func (c *Config) vaultPath() string {
+	return filepath.Join(c.configDir, vaultFileName)
+}
+
+// VaultEnabled reports whether private keys are stored encrypted
+func (c *Config) VaultEnabled() bool {
+	_, err := os.Stat(c.vaultPath())
+	return err == nil
+}
+
+// VaultUnlocked reports whether the vault key is available. It is true when
+// the vault is disabled.
+func (c *Config) VaultUnlocked() bool {
+	return !c.VaultEnabled() || c.vaultKey() != nil
+}
+
+func (c *Config) vaultKey() []byte {
+	vaultKeys.Lock()
+	defer vaultKeys.Unlock()
+	return vaultKeys.keys[c.configDir]
+}
+
+func (c *Config) setVaultKey(key []byte) {
+	vaultKeys.Lock()
+	defer vaultKeys.Unlock()
+	if key == nil {
+		delete(vaultKeys.keys, c.configDir)
+		return
+	}
+	vaultKeys.keys[c.configDir] = key
+}
+
+// UnlockVault asks for the master passphrase and keeps the derived key for
+// the rest of the process. It does nothing if the vault is disabled or
+// already unlocked.
+func (c *Config) UnlockVault(prompt VaultPrompt) error {
+	if c.VaultUnlocked() {
+		return nil
+	}
+	if prompt == nil {
+		return ErrVaultLocked
+	}
+
+	vf, err := c.readVaultFile()
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		passphrase, err := prompt(attempt)
+		if err != nil {
+			return err
+		}
+		key, err := vf.unlock(passphrase)
+		if errors.Is(err, errIncorrectMasterPassphrase) && attempt < maxVaultAttempts {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		c.setVaultKey(key)
+		return nil
+	}
+}
+
+// EnableVault turns vault mode on with a new master passphrase and encrypts
+// the private keys of all loaded profiles, whose names it returns
+func (c *Config) EnableVault(passphrase string) ([]string, error) {
+	if c.VaultEnabled() {
+		return nil, fmt.Errorf("the profile vault is already enabled")
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("master passphrase cannot be empty")
+	}
+	fileSecrets, err := c.usesFileSecrets()
+	if err != nil {
+		return nil, err
+	}
+	if fileSecrets {
+		return nil, fmt.Errorf("private keys are kept unencrypted by the %q secret backend; move them into the profile files first with 'ghpm settings set %s %s'",
+			secrets.FileBackendName, SettingSecretBackend, SecretBackendProfile)
+	}
+
+	vf, key, err := newVaultFile(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(vf, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal vault: %w", err)
+	}
+	if err := os.MkdirAll(c.configDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(c.vaultPath(), data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write vault: %w", err)
+	}
+	c.setVaultKey(key)
+
+	return c.EncryptProfiles()
+}
+
+// EncryptProfiles rewrites the profiles whose private key is still stored in
+// plaintext, e.g. after enabling the vault or copying a profile file into
+// the config directory, and encrypts the key files in backups taken before
+// the vault was enabled. It returns the names of the converted profiles.
+func (c *Config) EncryptProfiles() ([]string, error) {
+	if !c.VaultEnabled() {
+		return nil, fmt.Errorf("the profile vault is not enabled")
+	}
+
+	plaintext, err := c.PlaintextProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var converted []string
+	for _, name := range plaintext {
+		p, err := c.GetProfile(name)
+		if err != nil {
+			continue
+		}
+		if err := c.saveProfileToFile(p); err != nil {
+			return converted, fmt.Errorf("failed to encrypt profile '%s': %w", name, err)
+		}
+		converted = append(converted, name)
+	}
+
+	if _, err := c.storage.Backups.EncryptAll(); err != nil {
+		return converted, fmt.Errorf("failed to encrypt backups: %w", err)
+	}
+	return converted, nil
+}
+
+// DisableVault stores all private keys and backups in plaintext again and
+// turns vault mode off. The vault must be unlocked.
+func (c *Config) DisableVault() error {
+	if !c.VaultEnabled() {
+		return fmt.Errorf("the profile vault is not enabled")
+	}
+	if !c.VaultUnlocked() {
+		return ErrVaultLocked
+	}
+
+	// the vault file goes last, so an interrupted run can be repeated
+	for _, p := range c.GetProfiles() {
+		if p.SSHPrivateKeyRef != "" {
+			continue
+		}
+		if err := c.writeProfileFile(p); err != nil {
+			return fmt.Errorf("failed to decrypt profile '%s': %w", p.Name, err)
+		}
+	}
+	if _, err := c.storage.Backups.DecryptAll(); err != nil {
+		return fmt.Errorf("failed to decrypt backups: %w", err)
+	}
+	if err := os.Remove(c.vaultPath()); err != nil {
+		return fmt.Errorf("failed to remove vault: %w", err)
+	}
+	c.setVaultKey(nil)
+	return nil
+}
+
+// PlaintextProfiles returns the profiles whose file holds an unencrypted
+// private key. It reads the files directly, so it works while the vault is
+// locked.
+func (c *Config) PlaintextProfiles() ([]string, error) {
+	files, err := os.ReadDir(c.configDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(c.configDir, file.Name()))
+		if err != nil {
+			continue
+		}
+		var stored profile.Profile
+		if err := json.Unmarshal(data, &stored); err != nil {
+			continue
+		}
+		if stored.SSHPrivateKey != "" && !strings.HasPrefix(stored.SSHPrivateKey, vaultValuePrefix) {
+			names = append(names, stored.Name)
+		}
+	}
+	return names, nil
+}
+
+// sealProfile returns p as it is stored: without the private key if that
+// is kept in a secret backend, in vault mode a copy whose private key is
+// encrypted, otherwise p itself
+func (c *Config) sealProfile(p *profile.Profile) (*profile.Profile, error) {
+	if p.SSHPrivateKeyRef != "" {
+		stored := *p
+		stored.SSHPrivateKey = ""
+		return &stored, nil
+	}
+	if p.SSHPrivateKey == "" || !c.VaultEnabled() {
+		return p, nil
+	}
+	key := c.vaultKey()
+	if key == nil {
+		return nil, ErrVaultLocked
+	}
+
+	sealed, err := sealVaultValue(key, p.SSHPrivateKey, vaultAdditionalData(p.Name, "ssh_private_key"))
+	if err != nil {
+		return nil, err
+	}
+	stored := *p
+	stored.SSHPrivateKey = sealed
+	return &stored, nil
+}
+
+// openProfile decrypts the private key of a profile read from disk
+func (c *Config) openProfile(p *profile.Profile) error {
+	if !strings.HasPrefix(p.SSHPrivateKey, vaultValuePrefix) {
+		return nil
+	}
+	key := c.vaultKey()
+	if key == nil {
+		return ErrVaultLocked
+	}
+
+	privateKey, err := openVaultValue(key, p.SSHPrivateKey, vaultAdditionalData(p.Name, "ssh_private_key"))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt the private key of profile '%s': %w", p.Name, err)
+	}
+	p.SSHPrivateKey = privateKey
+	return nil
+}
+
+func (c *Config) readVaultFile() (*vaultFile, error) {
+	data, err := os.ReadFile(c.vaultPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault: %w", err)
+	}
+	var vf vaultFile
+	if err := json.Unmarshal(data, &vf); err != nil {
+		return nil, fmt.Errorf("failed to parse vault: %w", err)
+	}
+	if vf.Version != 1 || vf.KDF != "argon2id" {
+		return nil, fmt.Errorf("unsupported vault format (version %d, %s)", vf.Version, vf.KDF)
+	}
+	return &vf, nil
+}
+
+func newVaultFile(passphrase string) (*vaultFile, []byte, error) {
+	vf := &vaultFile{
+		Version: 1,
+		KDF:     "argon2id",
+		Salt:    make([]byte, vaultSaltSize),
+		Time:    vaultKDFTime,
+		Memory:  vaultKDFMemory,
+		Threads: vaultKDFThreads,
+	}
+	if _, err := rand.Read(vf.Salt); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := vf.deriveKey(passphrase)
+	check, err := sealVaultValue(key, vaultCheckText, []byte(vaultCheckText))
+	if err != nil {
+		return nil, nil, err
+	}
+	vf.Check = check
+	return vf, key, nil
+}
+
+func (vf *vaultFile) deriveKey(passphrase string) []byte {
+	return argon2.IDKey([]byte(passphrase), vf.Salt, vf.Time, vf.Memory, vf.Threads, chacha20poly1305.KeySize)
+}
+
+// unlock derives the key from passphrase and verifies it against the check
+// value
+func (vf *vaultFile) unlock(passphrase string) ([]byte, error) {
+	key := vf.deriveKey(passphrase)
+	check, err := openVaultValue(key, vf.Check, []byte(vaultCheckText))
+	if err != nil || subtle.ConstantTimeCompare([]byte(check), []byte(vaultCheckText)) != 1 {
+		return nil, errIncorrectMasterPassphrase
+	}
+	return key, nil
+}
+
+// vaultCipher encrypts the copies of key files in backups with the vault
+// key while the vault is enabled
+type vaultCipher struct {
+	c *Config
+}
+
+func (v vaultCipher) Enabled() bool {
+	return v.c.VaultEnabled()
+}
+
+func (v vaultCipher) Seal(path string, data []byte) ([]byte, error) {
+	key := v.c.vaultKey()
+	if key == nil {
+		return nil, ErrVaultLocked
+	}
+	sealed, err := sealVaultValue(key, string(data), vaultBackupAdditionalData(path))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sealed), nil
+}
+
+func (v vaultCipher) Open(path string, data []byte) ([]byte, error) {
+	key := v.c.vaultKey()
+	if key == nil {
+		return nil, ErrVaultLocked
+	}
+	plaintext, err := openVaultValue(key, string(data), vaultBackupAdditionalData(path))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(plaintext), nil
+}
+
+// vaultBackupAdditionalData binds an encrypted backup copy to the file it
+// was taken from
+func vaultBackupAdditionalData(path string) []byte {
+	return []byte("ghpm:backup:" + path)
+}
+
+// vaultAdditionalData binds an encrypted field to its profile, so values
+// cannot be swapped between profiles or fields unnoticed
+func vaultAdditionalData(profileName, field string) []byte {
+	return []byte("ghpm:" + profileName + ":" + field)
+}
+
+// sealVaultValue encrypts plaintext with XChaCha20-Poly1305 under a random
+// nonce
+func sealVaultValue(key []byte, plaintext string, additionalData []byte) (string, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), additionalData)
+	return vaultValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openVaultValue(key []byte, value string, additionalData []byte) (string, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %w", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, vaultValuePrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return "", fmt.Errorf("wrong vault key or damaged value")
+	}
+	return string(plaintext), nil
+}
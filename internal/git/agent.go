@@ -0,0 +1,171 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SSHKeyStrategy is how a switch hands the profile's key to ssh
+type SSHKeyStrategy string
+
+const (
+	// SSHKeyStrategyFiles writes the private key to ~/.ssh
+	SSHKeyStrategyFiles SSHKeyStrategy = "files"
+	// SSHKeyStrategyAgent adds the private key to the running ssh-agent and
+	// writes only the public key, which the ssh config points at
+	SSHKeyStrategyAgent SSHKeyStrategy = "agent"
+)
+
+// agentKeyCommentPrefix marks the agent keys added by ghpm, so they can be
+// told apart from keys the user added
+const agentKeyCommentPrefix = "ghpm:"
+
+// connectAgent connects to the ssh-agent named by SSH_AUTH_SOCK. The
+// returned function closes the connection.
+func connectAgent() (agent.ExtendedAgent, func(), error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, fmt.Errorf("ssh-agent is not running (SSH_AUTH_SOCK is not set)")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+	return agent.NewClient(conn), func() { conn.Close() }, nil
+}
+
+// AddKeyToAgent adds privateKey to ssh-agent, labelled with the profile name.
+// An encrypted key is unlocked with a passphrase from the passphrase prompt.
+// A non-zero lifetime makes the agent forget the key after that long. It
+// returns the public key and whether the agent already held it.
+func (g *Manager) AddKeyToAgent(profileName, privateKey string, lifetime time.Duration) (ssh.PublicKey, bool, error) {
+	key, err := g.parsePrivateKey(profileName, privateKey)
+	if err != nil {
+		return nil, false, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	client, closeAgent, err := connectAgent()
+	if err != nil {
+		return nil, false, err
+	}
+	defer closeAgent()
+
+	present, err := agentHasKey(client, signer.PublicKey())
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := client.Add(agent.AddedKey{
+		PrivateKey:   key,
+		Comment:      agentKeyCommentPrefix + profileName,
+		LifetimeSecs: uint32(lifetime / time.Second),
+	}); err != nil {
+		return nil, false, fmt.Errorf("failed to add key to ssh-agent: %w", err)
+	}
+
+	return signer.PublicKey(), present, nil
+}
+
+// RemoveAgentKey removes key from ssh-agent
+func (g *Manager) RemoveAgentKey(key ssh.PublicKey) error {
+	client, closeAgent, err := connectAgent()
+	if err != nil {
+		return err
+	}
+	defer closeAgent()
+
+	if err := client.Remove(key); err != nil {
+		return fmt.Errorf("failed to remove key from ssh-agent: %w", err)
+	}
+	return nil
+}
+
+// RemoveOtherAgentKeys removes every key ghpm added to ssh-agent except keep,
+// i.e. the identities of previously active profiles. Keys the user added
+// are left alone.
+func (g *Manager) RemoveOtherAgentKeys(keep ssh.PublicKey) error {
+	client, closeAgent, err := connectAgent()
+	if err != nil {
+		return err
+	}
+	defer closeAgent()
+
+	keys, err := client.List()
+	if err != nil {
+		return fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key.Comment, agentKeyCommentPrefix) {
+			continue
+		}
+		if keep != nil && bytes.Equal(key.Marshal(), keep.Marshal()) {
+			continue
+		}
+		if err := client.Remove(key); err != nil {
+			return fmt.Errorf("failed to remove %s from ssh-agent: %w", key.Comment, err)
+		}
+	}
+	return nil
+}
+
+// checkAgentKey verifies that ssh-agent holds the key of the public key file
+func (g *Manager) checkAgentKey(publicKeyPath string) error {
+	data, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read public key: %w", err)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse public key %s: %w", publicKeyPath, err)
+	}
+
+	client, closeAgent, err := connectAgent()
+	if err != nil {
+		return err
+	}
+	defer closeAgent()
+
+	present, err := agentHasKey(client, publicKey)
+	if err != nil {
+		return err
+	}
+	if !present {
+		return fmt.Errorf("ssh-agent does not hold the key %s; switch to the profile again to reload it", publicKeyPath)
+	}
+	return nil
+}
+
+func agentHasKey(client agent.ExtendedAgent, publicKey ssh.PublicKey) (bool, error) {
+	keys, err := client.List()
+	if err != nil {
+		return false, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+	for _, key := range keys {
+		if bytes.Equal(key.Marshal(), publicKey.Marshal()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// publicKeyPathFor returns the public key file of an identity file, which
+// with the agent strategy is the public key itself
+func publicKeyPathFor(identityFile string) string {
+	if strings.HasSuffix(identityFile, ".pub") {
+		return identityFile
+	}
+	return identityFile + ".pub"
+}
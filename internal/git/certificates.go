@@ -0,0 +1,153 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CertificateExpiryWarning is how long before it expires a certificate is
+// flagged as expiring soon
+const CertificateExpiryWarning = 7 * 24 * time.Hour
+
+// CertificateStatus tells whether a certificate can be used right now
+type CertificateStatus int
+
+const (
+	CertificateValid CertificateStatus = iota
+	CertificateExpiringSoon
+	CertificateExpired
+	CertificateNotYetValid
+)
+
+// CertificateInfo is what ghpm shows about an SSH certificate
+type CertificateInfo struct {
+	KeyID      string
+	Serial     uint64
+	Principals []string
+	ValidAfter time.Time
+	// ValidBefore is zero for a certificate that never expires
+	ValidBefore time.Time
+}
+
+// ParseSSHCertificate parses a user certificate in the authorized_keys
+// format, e.g. the content of id_ed25519-cert.pub
+func ParseSSHCertificate(content string) (*ssh.Certificate, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, fmt.Errorf("certificate is empty")
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(content))
+	if err != nil {
+		return nil, fmt.Errorf("certificate: %w", diagnosePublicKey(content))
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("this is a %s public key, not a certificate", key.Type())
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("this is a host certificate; a user certificate is needed")
+	}
+	if _, err := KeyTypeOf(cert.Key); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// ValidateSSHCertificate checks that certificate certifies publicKey
+func ValidateSSHCertificate(certificate, publicKey string) error {
+	cert, err := ParseSSHCertificate(certificate)
+	if err != nil {
+		return err
+	}
+	public, err := ParseSSHPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	if c, ok := public.(*ssh.Certificate); ok {
+		public = c.Key
+	}
+
+	if !bytes.Equal(cert.Key.Marshal(), public.Marshal()) {
+		return fmt.Errorf("the certificate is for the key %s, not for %s",
+			ssh.FingerprintSHA256(cert.Key), ssh.FingerprintSHA256(public))
+	}
+	return nil
+}
+
+// NewCertificateInfo summarizes cert
+func NewCertificateInfo(cert *ssh.Certificate) CertificateInfo {
+	info := CertificateInfo{
+		KeyID:      cert.KeyId,
+		Serial:     cert.Serial,
+		Principals: cert.ValidPrincipals,
+		ValidAfter: time.Unix(int64(cert.ValidAfter), 0),
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		info.ValidBefore = time.Unix(int64(cert.ValidBefore), 0)
+	}
+	return info
+}
+
+// Status returns whether the certificate is valid at now
+func (c CertificateInfo) Status(now time.Time) CertificateStatus {
+	switch {
+	case now.Before(c.ValidAfter):
+		return CertificateNotYetValid
+	case c.ValidBefore.IsZero():
+		return CertificateValid
+	case !now.Before(c.ValidBefore):
+		return CertificateExpired
+	case c.ValidBefore.Sub(now) < CertificateExpiryWarning:
+		return CertificateExpiringSoon
+	default:
+		return CertificateValid
+	}
+}
+
+// Warning describes why the certificate needs attention at now, or is empty
+// if it does not
+func (c CertificateInfo) Warning(now time.Time) string {
+	switch c.Status(now) {
+	case CertificateNotYetValid:
+		return "the SSH certificate is not valid before " + formatCertificateTime(c.ValidAfter)
+	case CertificateExpired:
+		return "the SSH certificate expired on " + formatCertificateTime(c.ValidBefore)
+	case CertificateExpiringSoon:
+		return fmt.Sprintf("the SSH certificate expires in %s, on %s",
+			formatCertificateDuration(c.ValidBefore.Sub(now)), formatCertificateTime(c.ValidBefore))
+	default:
+		return ""
+	}
+}
+
+// String lists the principals and the expiry of the certificate
+func (c CertificateInfo) String() string {
+	principals := "any principal"
+	if len(c.Principals) > 0 {
+		principals = "principals " + strings.Join(c.Principals, ", ")
+	}
+	if c.ValidBefore.IsZero() {
+		return principals + "; never expires"
+	}
+	return principals + "; valid until " + formatCertificateTime(c.ValidBefore)
+}
+
+func formatCertificateTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// formatCertificateDuration rounds d to days, or hours below two days
+func formatCertificateDuration(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%d days", int(d.Round(24*time.Hour)/(24*time.Hour)))
+	}
+	if d >= 2*time.Hour {
+		return fmt.Sprintf("%d hours", int(d.Round(time.Hour)/time.Hour))
+	}
+	return "less than 2 hours"
+}
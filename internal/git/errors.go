@@ -0,0 +1,258 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Kinds of failure; match them with errors.Is. The structured errors below
+// wrap one of them and carry the details, such as the raw output of ssh or
+// git, for errors.As.
+var (
+	ErrAuthFailed         = errors.New("SSH authentication failed")
+	ErrNetworkUnreachable = errors.New("network unreachable")
+	ErrTimeout            = errors.New("connection timed out")
+	ErrHostKeyMismatch    = errors.New("host key mismatch")
+	ErrWrongAccount       = errors.New("wrong GitHub account")
+	ErrGitNotFound        = errors.New("git is not installed")
+	ErrSSHNotFound        = errors.New("ssh is not installed")
+	ErrConfigWrite        = errors.New("failed to write configuration")
+	ErrConfigLocked       = errors.New("configuration file is locked")
+)
+
+// SSHError is a failed ssh command, e.g. a connection test
+type SSHError struct {
+	// Kind is ErrAuthFailed, ErrNetworkUnreachable, ErrTimeout or
+	// ErrSSHNotFound; nil if the failure was not recognized
+	Kind error
+	Host string
+	// Output is what ssh printed
+	Output string
+	// Err is the error of running ssh
+	Err error
+}
+
+func (e *SSHError) Error() string {
+	var msg string
+	switch e.Kind {
+	case ErrAuthFailed:
+		msg = fmt.Sprintf("SSH authentication to %s failed - check your SSH key", e.Host)
+	case ErrNetworkUnreachable:
+		msg = fmt.Sprintf("network error - could not connect to %s", e.Host)
+	case ErrTimeout:
+		msg = fmt.Sprintf("connection to %s timed out - check your network connection", e.Host)
+	case ErrSSHNotFound:
+		msg = "ssh is not installed or not in PATH"
+	default:
+		if errors.Is(e.Err, context.Canceled) {
+			return fmt.Sprintf("SSH test of %s was cancelled", e.Host)
+		}
+		msg = fmt.Sprintf("SSH test of %s failed: %v", e.Host, e.Err)
+	}
+	if output := strings.TrimSpace(e.Output); output != "" {
+		msg += ": " + output
+	}
+	return msg
+}
+
+func (e *SSHError) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// newSSHError classifies a failed ssh run by its error and output
+func newSSHError(host, output string, err error) *SSHError {
+	e := &SSHError{Host: host, Output: output, Err: err}
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		e.Kind = ErrSSHNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		e.Kind = ErrTimeout
+	case strings.Contains(output, "Permission denied"):
+		e.Kind = ErrAuthFailed
+	case strings.Contains(output, "Could not resolve hostname"),
+		strings.Contains(output, "Network is unreachable"),
+		strings.Contains(output, "No route to host"),
+		strings.Contains(output, "Connection refused"):
+		e.Kind = ErrNetworkUnreachable
+	case strings.Contains(output, "timed out"):
+		e.Kind = ErrTimeout
+	}
+	return e
+}
+
+// HostKeyMismatchError is returned by a connection test when the server
+// presents a host key that is not pinned for it: the connection may be
+// intercepted, or the server's keys changed
+type HostKeyMismatchError struct {
+	Host string
+	// Unknown is set when no key at all is pinned for the host
+	Unknown bool
+	// KnownHosts is the file the keys are pinned in
+	KnownHosts string
+	// Output is what ssh printed
+	Output string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	if e.Unknown {
+		return fmt.Sprintf("no host key is pinned for %s; add one with 'ghpm hostkey add %s FILE'", e.Host, e.Host)
+	}
+	return fmt.Sprintf("the host key of %s does not match the keys pinned in %s; "+
+		"someone may be intercepting the connection, or the server's keys changed", e.Host, e.KnownHosts)
+}
+
+func (e *HostKeyMismatchError) Is(target error) bool {
+	return target == ErrHostKeyMismatch
+}
+
+// WrongAccountError is returned by a connection test when the key works,
+// but for another GitHub account than the profile expects
+type WrongAccountError struct {
+	Host     string
+	Expected string
+	Login    string
+	// Output is what ssh printed
+	Output string
+}
+
+func (e *WrongAccountError) Error() string {
+	return fmt.Sprintf("%s authenticated the key as '%s', not as '%s'", e.Host, e.Login, e.Expected)
+}
+
+func (e *WrongAccountError) Is(target error) bool {
+	return target == ErrWrongAccount
+}
+
+// GitError is a failed git command
+type GitError struct {
+	Args []string
+	// Output is what git printed to stderr
+	Output string
+	Err    error
+}
+
+func (e *GitError) Error() string {
+	if errors.Is(e.Err, exec.ErrNotFound) {
+		return "git is not installed or not in PATH"
+	}
+	if errors.Is(e.Err, context.DeadlineExceeded) {
+		return fmt.Sprintf("git %s did not finish in time", strings.Join(e.Args, " "))
+	}
+	msg := fmt.Sprintf("git %s failed: %v", strings.Join(e.Args, " "), e.Err)
+	if output := strings.TrimSpace(e.Output); output != "" {
+		msg += ": " + output
+	}
+	return msg
+}
+
+func (e *GitError) Unwrap() []error {
+	if errors.Is(e.Err, exec.ErrNotFound) {
+		return []error{ErrGitNotFound, e.Err}
+	}
+	return []error{e.Err}
+}
+
+// ExitCode is git's exit status, or -1 if git did not run or was stopped
+func (e *GitError) ExitCode() int {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(e.Err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// runGit runs git through the Manager's runner and returns its standard
+// output; a failure is a *GitError
+func (g *Manager) runGit(ctx context.Context, args ...string) ([]byte, error) {
+	output, err := g.runner.Run(ctx, Command{Name: "git", Args: args, Timeout: gitCommandTimeout})
+	if err != nil {
+		return output.Stdout, &GitError{Args: args, Output: string(output.Stderr), Err: err}
+	}
+	return output.Stdout, nil
+}
+
+// ConfigWriteError is a configuration file, such as ~/.gitconfig or
+// ~/.ssh/config, that could not be written
+type ConfigWriteError struct {
+	Path string
+	Err  error
+}
+
+func (e *ConfigWriteError) Error() string {
+	return fmt.Sprintf("failed to write %s: %v", e.Path, e.Err)
+}
+
+func (e *ConfigWriteError) Unwrap() []error {
+	return []error{ErrConfigWrite, e.Err}
+}
+
+// SwitchError is returned when a profile switch fails. Everything the switch
+// had already changed is rolled back; RollbackErrors lists what could not be
+// restored, so an empty list means the system is exactly as before.
+type SwitchError struct {
+	Profile        string
+	Step           string
+	Err            error
+	RolledBack     []string
+	RollbackErrors []error
+}
+
+func (e *SwitchError) Error() string {
+	msg := fmt.Sprintf("switching to profile '%s' failed while %s: %v", e.Profile, e.Step, e.Err)
+	if len(e.RollbackErrors) > 0 {
+		return msg + fmt.Sprintf("; rollback incomplete: %v", errors.Join(e.RollbackErrors...))
+	}
+	if len(e.RolledBack) > 0 {
+		return msg + "; all changes were rolled back"
+	}
+	return msg + "; nothing was changed"
+}
+
+func (e *SwitchError) Unwrap() error {
+	return e.Err
+}
+
+// Remediation suggests how to fix the failure err describes, or returns an
+// empty string when there is no specific advice
+func Remediation(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ""
+	case errors.Is(err, ErrWrongAccount):
+		return "The key belongs to another GitHub account. Check that the profile has the right key, or correct its GitHub login."
+	case errors.Is(err, ErrHostKeyMismatch):
+		var hostKeyErr *HostKeyMismatchError
+		if errors.As(err, &hostKeyErr) && hostKeyErr.Unknown {
+			return "Pin the host's keys with 'ghpm hostkey add HOST FILE' after verifying them with its administrator."
+		}
+		return "Do not connect from this network until the host key is explained; compare it with the fingerprints the server's operator publishes."
+	case errors.Is(err, ErrAuthFailed):
+		return "Add the profile's public key to the GitHub account under Settings > SSH and GPG keys, and check that the profile is active."
+	case errors.Is(err, ErrNetworkUnreachable):
+		return "Check the network connection, a proxy or firewall blocking port 22, and the host name."
+	case errors.Is(err, ErrTimeout):
+		return "Check the network connection; if port 22 is blocked, GitHub also accepts SSH on ssh.github.com port 443."
+	case errors.Is(err, ErrGitNotFound):
+		return "Install git and make sure it is in PATH."
+	case errors.Is(err, ErrSSHNotFound):
+		return "Install the OpenSSH client and make sure ssh is in PATH."
+	case errors.Is(err, context.DeadlineExceeded):
+		return "git did not respond; check that no other git process holds a lock on the file."
+	case errors.Is(err, ErrConfigLocked):
+		return "Wait for the running git command to finish; if none is running, remove the .lock file next to the git config."
+	case errors.Is(err, ErrConfigWrite):
+		return "Check the permissions of the file and its directory, and that the disk is not full."
+	default:
+		return ""
+	}
+}
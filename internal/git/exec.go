@@ -0,0 +1,87 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// ExecWithProfile runs command with the profile's git identity and SSH key
+// supplied through the environment only. Global git config and ~/.ssh are
+// left untouched, and the temporary key is removed once the command exits.
+// It returns the exit code of the command. The command is attached to the
+// terminal, so it is started directly rather than through the runner.
+func (g *Manager) ExecWithProfile(profile ExecProfileInterface, command []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if len(command) == 0 {
+		return -1, fmt.Errorf("no command given")
+	}
+
+	if err := ValidateGitInput(profile.GetGitUsername(), profile.GetGitEmail()); err != nil {
+		return -1, fmt.Errorf("invalid git configuration: %w", err)
+	}
+
+	env := append(os.Environ(),
+		"GIT_AUTHOR_NAME="+profile.GetGitUsername(),
+		"GIT_AUTHOR_EMAIL="+profile.GetGitEmail(),
+		"GIT_COMMITTER_NAME="+profile.GetGitUsername(),
+		"GIT_COMMITTER_EMAIL="+profile.GetGitEmail(),
+	)
+
+	if profile.HasSSHKeys() {
+		privateKeyPath, cleanup, err := profile.WriteSSHKeysToTempDir()
+		if err != nil {
+			return -1, fmt.Errorf("failed to write temporary SSH key: %w", err)
+		}
+		defer cleanup()
+
+		env = append(env, "GIT_SSH_COMMAND="+sshCommandForKey(privateKeyPath))
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = env
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return -1, fmt.Errorf("failed to start %s: %w", command[0], err)
+	}
+
+	// Stay alive until the child exits so the temporary key is always removed.
+	// Ctrl-C already reaches the child through the terminal; SIGTERM is passed on.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGTERM {
+				cmd.Process.Signal(sig)
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("failed to run %s: %w", command[0], err)
+	}
+
+	return 0, nil
+}
+
+// sshCommandForKey builds a GIT_SSH_COMMAND value that only offers the given key
+func sshCommandForKey(privateKeyPath string) string {
+	quoted := "'" + strings.ReplaceAll(privateKeyPath, "'", `'\''`) + "'"
+	return "ssh -i " + quoted + " -o IdentitiesOnly=yes"
+}
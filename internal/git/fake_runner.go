@@ -0,0 +1,113 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// FakeResponse is how a FakeRunner answers a command
+type FakeResponse struct {
+	Output Output
+	Err    error
+	// Hang blocks the call until its context is done or its timeout passes,
+	// like a git or ssh that never returns
+	Hang bool
+}
+
+type fakeRule struct {
+	name     string
+	args     []string
+	response FakeResponse
+}
+
+// FakeRunner is a Runner that runs nothing: it records every command and
+// answers with the response registered for it, so a Manager can be used
+// without touching ~/.gitconfig, ~/.ssh or the network. Commands without a
+// registered response succeed with no output.
+type FakeRunner struct {
+	mu        sync.Mutex
+	rules     []fakeRule
+	calls     []Command
+	cancelled []Command
+}
+
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{}
+}
+
+// Respond answers commands named name whose arguments start with args.
+// When several responses match, the last one registered wins.
+func (f *FakeRunner) Respond(response FakeResponse, name string, args ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, fakeRule{name: name, args: args, response: response})
+}
+
+// Calls returns the commands run so far, in order
+func (f *FakeRunner) Calls() []Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// Cancelled returns the commands that were stopped by the cancellation of
+// their context, in order
+func (f *FakeRunner) Cancelled() []Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.cancelled)
+}
+
+// Reset forgets the recorded commands, keeping the responses
+func (f *FakeRunner) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+	f.cancelled = nil
+}
+
+func (f *FakeRunner) Run(ctx context.Context, cmd Command) (Output, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, cmd)
+	response := f.match(cmd)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		f.recordCancelled(cmd, err)
+		return Output{}, err
+	}
+	if response.Hang {
+		timeoutCtx := ctx
+		if cmd.Timeout > 0 {
+			var cancel context.CancelFunc
+			timeoutCtx, cancel = context.WithTimeout(ctx, cmd.Timeout)
+			defer cancel()
+		}
+		<-timeoutCtx.Done()
+		f.recordCancelled(cmd, ctx.Err())
+		return response.Output, timeoutCtx.Err()
+	}
+	return response.Output, response.Err
+}
+
+// recordCancelled records cmd if err is the cancellation of its context,
+// rather than its timeout
+func (f *FakeRunner) recordCancelled(cmd Command, err error) {
+	if errors.Is(err, context.Canceled) {
+		f.mu.Lock()
+		f.cancelled = append(f.cancelled, cmd)
+		f.mu.Unlock()
+	}
+}
+
+func (f *FakeRunner) match(cmd Command) FakeResponse {
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		rule := f.rules[i]
+		if rule.name == cmd.Name && len(cmd.Args) >= len(rule.args) && slices.Equal(cmd.Args[:len(rule.args)], rule.args) {
+			return rule.response
+		}
+	}
+	return FakeResponse{}
+}
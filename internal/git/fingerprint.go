@@ -0,0 +1,140 @@
+package git
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyFingerprint identifies a public key the way ssh-keygen -l does
+type KeyFingerprint struct {
+	Type KeyType
+	Bits int
+	// SHA256 and MD5 are formatted like ssh-keygen -E sha256 and -E md5
+	SHA256  string
+	MD5     string
+	Comment string
+	// Randomart is the visual host key of ssh-keygen -lv
+	Randomart string
+}
+
+// FingerprintSSHPublicKey computes the fingerprints of a public key in the
+// authorized_keys format. A certificate has the fingerprints of the key it
+// certifies.
+func FingerprintSSHPublicKey(content string) (*KeyFingerprint, error) {
+	key, err := ParseSSHPublicKey(content)
+	if err != nil {
+		return nil, err
+	}
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	t, err := KeyTypeOf(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := &KeyFingerprint{
+		Type:   t,
+		Bits:   keyBits(t, key),
+		SHA256: ssh.FingerprintSHA256(key),
+		MD5:    "MD5:" + ssh.FingerprintLegacyMD5(key),
+	}
+	if _, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(content))); err == nil {
+		fingerprint.Comment = comment
+	}
+	fingerprint.Randomart = randomart(key, fingerprint.Type.Label, fingerprint.Bits)
+	return fingerprint, nil
+}
+
+// String formats the fingerprint like a line of ssh-keygen -l
+func (f *KeyFingerprint) String() string {
+	comment := f.Comment
+	if comment == "" {
+		comment = "no comment"
+	}
+	return fmt.Sprintf("%d %s %s (%s)", f.Bits, f.SHA256, comment, f.Type.Label)
+}
+
+// Matches reports whether f and other are fingerprints of the same key
+func (f *KeyFingerprint) Matches(other *KeyFingerprint) bool {
+	return other != nil && f.SHA256 == other.SHA256
+}
+
+func keyBits(t KeyType, key ssh.PublicKey) int {
+	if t.Bits != 0 {
+		return t.Bits
+	}
+	if crypto, ok := key.(ssh.CryptoPublicKey); ok {
+		if rsaKey, ok := crypto.CryptoPublicKey().(*rsa.PublicKey); ok {
+			return rsaKey.N.BitLen()
+		}
+	}
+	return 0
+}
+
+// Size of the randomart field and the characters for how often the bishop
+// visited a cell, as in OpenSSH's sshkey.c
+const (
+	randomartWidth   = 17
+	randomartHeight  = 9
+	randomartSymbols = " .o+=*BOX@%&#/^SE"
+)
+
+// randomart draws the SHA256 digest of key with the drunken bishop
+// algorithm, so the result can be compared with ssh-keygen -lv
+func randomart(key ssh.PublicKey, label string, bits int) string {
+	digest := sha256.Sum256(key.Marshal())
+
+	// the last two symbols mark the start and the end of the walk
+	maxVisits := len(randomartSymbols) - 1
+	var field [randomartWidth][randomartHeight]int
+	x, y := randomartWidth/2, randomartHeight/2
+	for _, b := range digest {
+		for i := 0; i < 4; i++ {
+			if b&1 != 0 {
+				x = min(x+1, randomartWidth-1)
+			} else {
+				x = max(x-1, 0)
+			}
+			if b&2 != 0 {
+				y = min(y+1, randomartHeight-1)
+			} else {
+				y = max(y-1, 0)
+			}
+			if field[x][y] < maxVisits-2 {
+				field[x][y]++
+			}
+			b >>= 2
+		}
+	}
+	field[randomartWidth/2][randomartHeight/2] = maxVisits - 1
+	field[x][y] = maxVisits
+
+	title := fmt.Sprintf("[%s %d]", label, bits)
+	if len(title) > randomartWidth {
+		title = "[" + label + "]"
+	}
+
+	var art strings.Builder
+	art.WriteString(randomartBorder(title))
+	for y := 0; y < randomartHeight; y++ {
+		art.WriteByte('|')
+		for x := 0; x < randomartWidth; x++ {
+			art.WriteByte(randomartSymbols[min(field[x][y], maxVisits)])
+		}
+		art.WriteString("|\n")
+	}
+	art.WriteString(randomartBorder("[SHA256]"))
+	return strings.TrimSuffix(art.String(), "\n")
+}
+
+// randomartBorder is a horizontal border with label centered in it
+func randomartBorder(label string) string {
+	left := (randomartWidth - len(label)) / 2
+	return "+" + strings.Repeat("-", left) + label +
+		strings.Repeat("-", randomartWidth-left-len(label)) + "+\n"
+}
@@ -1,40 +1,145 @@
 package git
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/huzaifanur/ghpm/pkg/logger"
 )
 
-type Manager struct{}
+type Manager struct {
+	runner           Runner
+	keyStrategy      SSHKeyStrategy
+	agentKeyLifetime time.Duration
+	passphrasePrompt PassphrasePrompt
+	knownHosts       *KnownHosts
+}
 
 func NewManager() *Manager {
-	return &Manager{}
+	return NewManagerWithRunner(ExecRunner{})
+}
+
+// NewManagerWithRunner returns a Manager that runs git and ssh through
+// runner, e.g. a FakeRunner
+func NewManagerWithRunner(runner Runner) *Manager {
+	return &Manager{runner: runner, keyStrategy: SSHKeyStrategyFiles}
+}
+
+// SetSSHKeyStrategy selects how switches hand profile keys to ssh. lifetime
+// only applies to the agent strategy; zero keeps keys until removed.
+func (g *Manager) SetSSHKeyStrategy(strategy SSHKeyStrategy, lifetime time.Duration) {
+	g.keyStrategy = strategy
+	g.agentKeyLifetime = lifetime
+}
+
+// SetKnownHosts selects the known_hosts file connection tests run against
+func (g *Manager) SetKnownHosts(knownHosts *KnownHosts) {
+	g.knownHosts = knownHosts
+}
+
+// SSHKeyStrategy returns how switches hand profile keys to ssh
+func (g *Manager) SSHKeyStrategy() SSHKeyStrategy {
+	return g.keyStrategy
 }
 
-func (g *Manager) SwitchProfile(profile ProfileInterface) error {
+// SwitchProfile applies the profile's git identity and SSH keys as one
+// transaction. commit, if not nil, runs once everything is applied, typically
+// to mark the profile active. If any step or commit fails, the previous git
+// config values and files are restored and a *SwitchError describing the
+// failure and the rollback is returned. Cancelling ctx stops the switch and
+// rolls it back, unless commit already ran.
+func (g *Manager) SwitchProfile(ctx context.Context, profile ProfileInterface, commit func() error) error {
 	log := logger.New()
 	defer log.Close()
 
+	tx, err := g.beginSwitch(profile)
+	if err != nil {
+		return &SwitchError{Profile: profile.GetName(), Step: "recording the current configuration", Err: err}
+	}
+
+	fail := func(step string, err error) error {
+		switchErr := &SwitchError{Profile: profile.GetName(), Step: step, Err: err}
+		switchErr.RolledBack, switchErr.RollbackErrors = tx.rollback(g)
+		log.Errorw("Profile switch failed",
+			"name", profile.GetName(),
+			"step", step,
+			"error", err,
+			"rolled_back", switchErr.RolledBack,
+			"rollback_errors", switchErr.RollbackErrors)
+		return switchErr
+	}
+
+	// first, as it may ask for a passphrase: an encrypted key is unlocked
+	// into the agent whatever the strategy, since ssh cannot ask for it
+	// without a terminal
+	if profile.HasSSHKeys() {
+		privateKey, err := profile.GetSSHPrivateKey()
+		if err != nil {
+			return fail("loading the SSH private key", err)
+		}
+		// ghpm cannot load security keys into the agent; ssh reads them
+		// from their file and talks to the token itself
+		keyType, _, _ := PrivateKeyType(privateKey)
+		if !keyType.SecurityKey && (g.keyStrategy == SSHKeyStrategyAgent || IsEncryptedPrivateKey(privateKey)) {
+			key, present, err := g.AddKeyToAgent(profile.GetName(), privateKey, g.agentKeyLifetime)
+			if err != nil {
+				return fail("adding the SSH key to ssh-agent", err)
+			}
+			tx.agentKey = key
+			tx.agentKeyWasPresent = present
+		}
+	}
+
 	if err := g.setGitConfig(profile.GetGitUsername(), profile.GetGitEmail()); err != nil {
-		return fmt.Errorf("failed to set git config: %w", err)
+		return fail("setting git config", err)
 	}
 
 	if profile.HasSSHKeys() {
-		if err := profile.WriteSSHKeysToSystem(); err != nil {
-			return fmt.Errorf("failed to write SSH keys: %w", err)
+		if err := profile.WriteSSHKeysToSystem(g.keyStrategy); err != nil {
+			return fail("writing SSH keys", err)
 		}
+	}
 
-		if err := g.TestSSHConnection(); err != nil {
+	// the connection test is the step that waits on the network, so it runs
+	// while cancelling can still roll the switch back; other failures only
+	// warn, as the identity is applied either way
+	if profile.HasSSHKeys() {
+		if _, err := g.TestSSHConnection(ctx, profile.GetGitHubLogin()); err != nil {
+			if ctx.Err() != nil {
+				if !errors.Is(err, ctx.Err()) {
+					err = errors.Join(ctx.Err(), err)
+				}
+				return fail("testing the SSH connection", err)
+			}
 			log.Warnw("SSH test failed after switching profile", "error", err)
 		}
 	}
 
+	// past this point the switch is done, so this is the last chance to stop it
+	if err := ctx.Err(); err != nil {
+		return fail("applying the profile", err)
+	}
+
+	if commit != nil {
+		if err := commit(); err != nil {
+			return fail("activating the profile", err)
+		}
+	}
+
+	// keys of previous profiles, or all of ghpm's keys when they are written
+	// to files now, are dropped from the agent
+	if tx.agentKey != nil || os.Getenv("SSH_AUTH_SOCK") != "" {
+		if err := g.RemoveOtherAgentKeys(tx.agentKey); err != nil {
+			log.Warnw("Failed to remove previous profile keys from ssh-agent", "error", err)
+		}
+	}
+
 	log.Infow("Switched to profile",
 		"name", profile.GetName(),
 		"username", profile.GetGitUsername(),
@@ -47,87 +152,119 @@ func (g *Manager) setGitConfig(username, email string) error {
         return fmt.Errorf("invalid git configuration: %w", err)
     }
 
-	cmd := exec.Command("git", "config", "--global", "user.name", username)
-	if err := cmd.Run(); err != nil {
+	cfg, err := readGlobalGitConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Set("user.name", username); err != nil {
 		return fmt.Errorf("failed to set git username: %w", err)
 	}
 
-	cmd = exec.Command("git", "config", "--global", "user.email", email)
-	if err := cmd.Run(); err != nil {
+	if err := cfg.Set("user.email", email); err != nil {
 		return fmt.Errorf("failed to set git email: %w", err)
 	}
 
-	return nil
+	// both keys change in one write
+	return cfg.Write()
 }
 
+// GetCurrentGitConfig returns the identity git uses outside bound
+// directories: the last user.name and user.email in the global git config
+// files and the files they include unconditionally
 func (g *Manager) GetCurrentGitConfig() (username, email string, err error) {
-	cmd := exec.Command("git", "config", "--global", "user.name")
-	output, err := cmd.Output()
+	cfg, err := readMergedGlobalGitConfig(true)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get git username: %w", err)
+		return "", "", err
 	}
-	username = strings.TrimSpace(string(output))
 
-	cmd = exec.Command("git", "config", "--global", "user.email")
-	output, err = cmd.Output()
-	if err != nil {
-		return "", "", fmt.Errorf("failed to get git email: %w", err)
+	username, ok := cfg.Get("user.name")
+	if !ok {
+		return "", "", fmt.Errorf("failed to get git username: user.name is not set in %s", cfg.Path())
+	}
+
+	email, ok = cfg.Get("user.email")
+	if !ok {
+		return "", "", fmt.Errorf("failed to get git email: user.email is not set in %s", cfg.Path())
 	}
-	email = strings.TrimSpace(string(output))
 
 	return username, email, nil
 }
 
-func (g *Manager) TestSSHConnection() error {
-    privateKeyPath, _, err := DetectSSHKeyPaths()
-	if err != nil {
-		return fmt.Errorf("no SSH keys found: %w", err)
+// TestSSHConnection connects to GitHub with whatever key ssh picks for
+// github.com, i.e. the active profile's key from the ghpm-managed block of
+// ~/.ssh/config or the default key files. With the agent strategy it first
+// checks that ssh-agent holds that key. It returns the login GitHub
+// authenticated the key as; see TestSSHHost for expectedLogin.
+func (g *Manager) TestSSHConnection(ctx context.Context, expectedLogin string) (string, error) {
+	if g.keyStrategy == SSHKeyStrategyAgent {
+		// the ssh config points at the public key; the agent must hold its pair
+		identityFile, err := g.ActiveSSHKeyPath(ctx)
+		if err != nil {
+			return "", err
+		}
+		if err := g.checkAgentKey(publicKeyPathFor(identityFile)); err != nil {
+			return "", err
+		}
+	} else {
+		if err := g.checkSSHKeyPermissions(ctx); err != nil {
+			return "", fmt.Errorf("SSH key permissions error: %w", err)
+		}
+		// ssh runs in batch mode, so an encrypted key only works from the agent
+		if identityFile, err := g.ActiveSSHKeyPath(ctx); err == nil {
+			if data, err := os.ReadFile(identityFile); err == nil && IsEncryptedPrivateKey(string(data)) {
+				if err := g.checkAgentKey(publicKeyPathFor(identityFile)); err != nil {
+					return "", fmt.Errorf("%s is passphrase protected and not unlocked: %w", identityFile, err)
+				}
+			}
+		}
 	}
 
-	if _, err := os.Stat(privateKeyPath); err != nil {
-		return fmt.Errorf("SSH private key not found at %s", privateKeyPath)
-	}
+	return g.TestSSHHost(ctx, GitHubHost, expectedLogin)
+}
 
-	if err := g.checkSSHKeyPermissions(); err != nil {
-		return fmt.Errorf("SSH key permissions error: %w", err)
+// TestSSHHost connects to host as git, trusting only the host keys pinned
+// in the Manager's known_hosts file, and returns the login the server greeted the key with.
+// A host key that does not match them is reported as a *HostKeyMismatchError.
+// If expectedLogin is set and the key belongs to another account, the login
+// is returned with a *WrongAccountError. Other failures, including a
+// cancelled ctx, are an *SSHError.
+func (g *Manager) TestSSHHost(ctx context.Context, host, expectedLogin string) (string, error) {
+	if g.knownHosts == nil {
+		return "", fmt.Errorf("no known_hosts file is set for SSH tests")
 	}
-
-	cmd := exec.Command("ssh", "-T", "-o", "StrictHostKeyChecking=no", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10", "git@github.com")
-	output, err := cmd.CombinedOutput()
-
-	outputStr := string(output)
-
-	if containsSuccessMessage(outputStr) {
-		return nil
+	if err := g.knownHosts.Write(); err != nil {
+		return "", err
 	}
 
-	if err != nil {
-		return fmt.Errorf("SSH command failed: %v, output: %s", err, outputStr)
-	}
+	output, err := g.runner.Run(ctx, Command{Name: "ssh", Args: []string{"-T",
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", "UserKnownHostsFile=" + g.knownHosts.Path(),
+		"-o", "GlobalKnownHostsFile=/dev/null",
+		"-o", "UpdateHostKeys=no",
+		"-o", "BatchMode=yes", "-o", "ConnectTimeout=10", "git@" + host},
+		Timeout: sshTestTimeout})
 
-	if strings.Contains(outputStr, "Permission denied") {
-		return fmt.Errorf("SSH authentication failed - check your SSH key")
-	}
+	// GitHub greets on stderr
+	outputStr := string(output.Stdout) + string(output.Stderr)
 
-	if strings.Contains(outputStr, "Could not resolve hostname") {
-		return fmt.Errorf("network error - could not connect to GitHub")
+	if login, ok := authenticatedLogin(outputStr); ok {
+		if expectedLogin != "" && !strings.EqualFold(login, expectedLogin) {
+			return login, &WrongAccountError{Host: host, Expected: expectedLogin, Login: login, Output: outputStr}
+		}
+		return login, nil
 	}
 
-	if strings.Contains(outputStr, "Connection timed out") {
-		return fmt.Errorf("connection timeout - check your network connection")
+	if strings.Contains(outputStr, "Host key verification failed") {
+		return "", &HostKeyMismatchError{Host: host, Unknown: strings.Contains(outputStr, "host key is known for"), KnownHosts: g.knownHosts.Path(), Output: outputStr}
 	}
 
-	return fmt.Errorf("SSH test failed: %s", outputStr)
+	return "", newSSHError(host, outputStr, err)
 }
 
-func (g *Manager) checkSSHKeyPermissions() error {
+func (g *Manager) checkSSHKeyPermissions(ctx context.Context) error {
 	sshDir := os.ExpandEnv("$HOME/.ssh")
 
-    privateKeyPath, publicKeyPath, err := DetectSSHKeyPaths()
-	if err != nil {
-		return fmt.Errorf("no SSH keys found: %w", err)
-	}
-
 	if info, err := os.Stat(sshDir); err == nil {
 		if info.Mode().Perm() != 0700 {
 			if err := os.Chmod(sshDir, 0700); err != nil {
@@ -136,6 +273,13 @@ func (g *Manager) checkSSHKeyPermissions() error {
 		}
 	}
 
+	// without a key there is nothing to fix; the connection test reports it
+	privateKeyPath, err := g.ActiveSSHKeyPath(ctx)
+	if err != nil {
+		return nil
+	}
+	publicKeyPath := privateKeyPath + ".pub"
+
 	if info, err := os.Stat(privateKeyPath); err == nil {
 		if info.Mode().Perm() != 0600 {
 			if err := os.Chmod(privateKeyPath, 0600); err != nil {
@@ -155,73 +299,126 @@ func (g *Manager) checkSSHKeyPermissions() error {
 	return nil
 }
 
-func containsSuccessMessage(output string) bool {
-	successMessages := []string{
-		"successfully authenticated",
-		"You've successfully authenticated",
-		"Hi ",
-	}
+// githubGreeting is GitHub's reply to ssh -T; a deploy key is greeted with
+// the repository instead of a login
+var githubGreeting = regexp.MustCompile(`Hi ([A-Za-z0-9-]+(?:/[A-Za-z0-9._-]+)?)! You've successfully authenticated`)
 
-	outputLower := strings.ToLower(output)
-	for _, msg := range successMessages {
-		if strings.Contains(outputLower, strings.ToLower(msg)) {
-			return true
-		}
+// authenticatedLogin returns the login GitHub greeted the key with
+func authenticatedLogin(output string) (string, bool) {
+	match := githubGreeting.FindStringSubmatch(output)
+	if match == nil {
+		return "", false
 	}
+	return match[1], true
+}
 
-	return false
+// githubLoginPattern matches GitHub user and organization names. New names
+// may not have leading, trailing or double hyphens, but older accounts with
+// them still exist.
+var githubLoginPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,39}$`)
+
+// ValidateGitHubLogin checks that login can be a GitHub account name
+func ValidateGitHubLogin(login string) error {
+	if !githubLoginPattern.MatchString(login) {
+		return fmt.Errorf("invalid GitHub login %q", login)
+	}
+	return nil
 }
 
+// ValidateSSHKey checks that keyContent is a private key in the OpenSSH, PEM
+// or PKCS#8 format, or a public key in the authorized_keys format
 func (g *Manager) ValidateSSHKey(keyContent string, isPrivate bool) error {
-	if strings.TrimSpace(keyContent) == "" {
-		return fmt.Errorf("SSH key content is empty")
+	if isPrivate {
+		_, err := ParseSSHPrivateKey(keyContent)
+		return err
 	}
+	_, err := ParseSSHPublicKey(keyContent)
+	return err
+}
 
-	if isPrivate {
-		if !strings.Contains(keyContent, "BEGIN") || !strings.Contains(keyContent, "PRIVATE KEY") {
-			return fmt.Errorf("invalid private key format")
-		}
-	} else {
-		if !strings.HasPrefix(strings.TrimSpace(keyContent), "ssh-") {
-			return fmt.Errorf("invalid public key format")
-		}
+// ValidateIdentityFile checks a private key file a profile uses in place: it
+// must be a regular file only its owner can access, like ssh demands, with
+// its matching public key next to it
+func ValidateIdentityFile(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("key file path must be absolute: %s", path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("private key file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("private key %s is not a regular file", path)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("private key %s can be accessed by other users (mode %04o); run chmod 600 on it", path, perm)
 	}
 
+	privateKey, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("private key file: %w", err)
+	}
+	publicKey, err := os.ReadFile(publicKeyPathFor(path))
+	if err != nil {
+		return fmt.Errorf("public key file: %w", err)
+	}
+	if err := ValidateSSHKeyPair(string(privateKey), string(publicKey)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
 	return nil
 }
 
-func (g *Manager) GetSSHKeyFingerprint() (string, error) {
-    _, publicKeyPath, err := DetectSSHKeyPaths()
+// GetSSHKeyFingerprint returns the fingerprint of the key ssh uses for github.com
+func (g *Manager) GetSSHKeyFingerprint(ctx context.Context) (*KeyFingerprint, error) {
+	privateKeyPath, err := g.ActiveSSHKeyPath(ctx)
 	if err != nil {
-		return "", fmt.Errorf("no SSH keys found: %w", err)
+		return nil, fmt.Errorf("no SSH keys found: %w", err)
 	}
 
-	if _, err := os.Stat(publicKeyPath); err != nil {
-		return "", fmt.Errorf("public key not found")
+	return g.GetSSHKeyFingerprintForFile(publicKeyPathFor(privateKeyPath))
+}
+
+// ActiveSSHKeyPath returns the identity file ssh actually uses for github.com:
+// the first one from the resolved ssh configuration that exists. This is the
+// active profile's key when the ghpm-managed block is in place, whatever
+// other key files are lying around in ~/.ssh. With the agent strategy it is
+// the public key of the pair held by ssh-agent.
+func (g *Manager) ActiveSSHKeyPath(ctx context.Context) (string, error) {
+	files, err := g.SSHIdentityFiles(ctx, GitHubHost)
+	if err != nil {
+		return "", err
+	}
+	for _, path := range files {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
 	}
+	return "", fmt.Errorf("no SSH key pair found")
+}
 
-	cmd := exec.Command("ssh-keygen", "-lf", publicKeyPath)
-	output, err := cmd.Output()
+// GetSSHKeyFingerprintForFile returns the fingerprint of a public key file
+func (g *Manager) GetSSHKeyFingerprintForFile(publicKeyPath string) (*KeyFingerprint, error) {
+	content, err := os.ReadFile(publicKeyPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to get fingerprint: %w", err)
+		return nil, fmt.Errorf("public key not found: %w", err)
 	}
 
-	return strings.TrimSpace(string(output)), nil
+	fingerprint, err := FingerprintSSHPublicKey(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", publicKeyPath, err)
+	}
+	return fingerprint, nil
 }
 
+// DetectSSHKeyPaths returns the first key pair in ~/.ssh under one of the
+// default file names of KeyTypes
 func DetectSSHKeyPaths() (string, string, error) {
 	sshDir := os.ExpandEnv("$HOME/.ssh")
 
-	keyTypes := []string{
-		"id_ed25519",
-		"id_ecdsa",
-		"id_rsa",
-		"id_dsa",
-	}
-
-	for _, keyType := range keyTypes {
-		privateKeyPath := filepath.Join(sshDir, keyType)
-		publicKeyPath := filepath.Join(sshDir, keyType+".pub")
+	for _, fileName := range keyFileNames() {
+		privateKeyPath := filepath.Join(sshDir, fileName)
+		publicKeyPath := filepath.Join(sshDir, fileName+".pub")
 
 		if _, err := os.Stat(privateKeyPath); err == nil {
 			if _, err := os.Stat(publicKeyPath); err == nil {
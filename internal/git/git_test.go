@@ -0,0 +1,274 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTempHome points HOME, and with it ~/.gitconfig and ~/.ssh, at a new
+// temporary directory and returns it
+func useTempHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_CONFIG_GLOBAL", "")
+	t.Setenv("SSH_AUTH_SOCK", "")
+	return home
+}
+
+// waitForCall waits until runner has been asked to run a command named name
+// whose arguments start with args
+func waitForCall(t *testing.T, runner *FakeRunner, name string, args ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if slices.ContainsFunc(runner.Calls(), func(c Command) bool {
+			return c.Name == name && len(c.Args) >= len(args) && slices.Equal(c.Args[:len(args)], args)
+		}) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%s %s was never run", name, strings.Join(args, " "))
+}
+
+// testProfile writes its key file in WriteSSHKeysToSystem, leaving
+// ~/.ssh/config alone
+type testProfile struct {
+	keyPath    string
+	privateKey string
+}
+
+func (p *testProfile) GetName() string        { return "test" }
+func (p *testProfile) GetGitUsername() string { return "Test User" }
+func (p *testProfile) GetGitEmail() string    { return "test@example.com" }
+func (p *testProfile) GetGitHubLogin() string { return "" }
+func (p *testProfile) HasSSHKeys() bool       { return true }
+func (p *testProfile) SSHFilePaths() []string { return []string{p.keyPath} }
+
+func (p *testProfile) GetSSHPrivateKey() (string, error) {
+	return p.privateKey, nil
+}
+
+func (p *testProfile) WriteSSHKeysToSystem(strategy SSHKeyStrategy) error {
+	return os.WriteFile(p.keyPath, []byte(p.privateKey), 0600)
+}
+
+func newTestProfile(t *testing.T, home string) *testProfile {
+	t.Helper()
+	privateKey, _, err := GenerateSSHKey("test@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return &testProfile{keyPath: filepath.Join(home, ".ssh", "ghpm_test"), privateKey: privateKey}
+}
+
+const previousGitConfig = "# my identity\n[user]\n\tname = Previous User\n\temail = previous@example.com\n"
+
+// newSwitchManager returns a Manager whose ssh -G points github.com at the
+// test profile's key and whose ssh -T answers with response
+func newSwitchManager(t *testing.T, home string, p *testProfile, response FakeResponse) (*Manager, *FakeRunner) {
+	t.Helper()
+	runner := NewFakeRunner()
+	runner.Respond(FakeResponse{Output: Output{Stdout: []byte("hostname github.com\nidentityfile " + p.keyPath + "\n")}}, "ssh", "-G")
+	runner.Respond(response, "ssh", "-T")
+	g := NewManagerWithRunner(runner)
+	g.SetKnownHosts(NewKnownHosts(filepath.Join(home, "known_hosts")))
+	return g, runner
+}
+
+func TestSwitchProfileCancelledWhileTestingConnection(t *testing.T) {
+	home := useTempHome(t)
+	gitConfigPath := filepath.Join(home, ".gitconfig")
+	if err := os.WriteFile(gitConfigPath, []byte(previousGitConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProfile(t, home)
+	g, runner := newSwitchManager(t, home, p, FakeResponse{Hang: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	committed := false
+	done := make(chan error, 1)
+	go func() {
+		done <- g.SwitchProfile(ctx, p, func() error {
+			committed = true
+			return nil
+		})
+	}()
+
+	waitForCall(t, runner, "ssh", "-T")
+	cancel()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the switch did not stop when cancelled")
+	}
+
+	var switchErr *SwitchError
+	if !errors.As(err, &switchErr) {
+		t.Fatalf("got %v, want a *SwitchError", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if len(switchErr.RollbackErrors) > 0 {
+		t.Errorf("rollback failed: %v", switchErr.RollbackErrors)
+	}
+	if committed {
+		t.Error("a cancelled switch was committed")
+	}
+	cancelled := runner.Cancelled()
+	if len(cancelled) != 1 || cancelled[0].Name != "ssh" || cancelled[0].Args[0] != "-T" {
+		t.Errorf("cancelled commands %v, want the ssh -T connection test", cancelled)
+	}
+
+	cfg, err := ReadGitConfig(gitConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"user.name": "Previous User", "user.email": "previous@example.com"} {
+		if got, _ := cfg.Get(key); got != want {
+			t.Errorf("%s = %q after the rollback, want %q", key, got, want)
+		}
+	}
+	if data, err := os.ReadFile(gitConfigPath); err != nil || string(data) != previousGitConfig {
+		t.Errorf("~/.gitconfig was not restored: %q, %v", data, err)
+	}
+	if _, err := os.Stat(p.keyPath); !os.IsNotExist(err) {
+		t.Errorf("the key file written by the switch was not removed: %v", err)
+	}
+}
+
+func TestSwitchProfileConnectionTestFails(t *testing.T) {
+	home := useTempHome(t)
+	p := newTestProfile(t, home)
+	g, runner := newSwitchManager(t, home, p, FakeResponse{
+		Output: Output{Stderr: []byte("ssh: Could not resolve hostname github.com\n")},
+		Err:    ExitStatus(255),
+	})
+
+	// a failed test only warns: the identity is applied either way
+	committed := false
+	if err := g.SwitchProfile(context.Background(), p, func() error {
+		committed = true
+		return nil
+	}); err != nil {
+		t.Fatalf("SwitchProfile: %v", err)
+	}
+	if !committed {
+		t.Error("the switch was not committed")
+	}
+	if cancelled := runner.Cancelled(); len(cancelled) != 0 {
+		t.Errorf("cancelled commands %v, want none", cancelled)
+	}
+
+	username, email, err := g.GetCurrentGitConfig()
+	if err != nil || username != "Test User" || email != "test@example.com" {
+		t.Errorf("GetCurrentGitConfig = %q, %q, %v; want the switched identity", username, email, err)
+	}
+}
+
+func TestManagerRecordsCommands(t *testing.T) {
+	home := useTempHome(t)
+	keyPath := filepath.Join(home, ".ssh", "ghpm_work")
+
+	runner := NewFakeRunner()
+	runner.Respond(FakeResponse{Output: Output{Stdout: []byte("hostname github.com\nidentityfile " + keyPath + "\n")}}, "ssh", "-G")
+	runner.Respond(FakeResponse{
+		Output: Output{Stderr: []byte("Hi octocat! You've successfully authenticated, but GitHub does not provide shell access.\n")},
+		Err:    ExitStatus(1),
+	}, "ssh", "-T")
+	g := NewManagerWithRunner(runner)
+	knownHosts := NewKnownHosts(filepath.Join(home, "known_hosts"))
+	g.SetKnownHosts(knownHosts)
+
+	files, err := g.SSHIdentityFiles(context.Background(), GitHubHost)
+	if err != nil || !slices.Equal(files, []string{keyPath}) {
+		t.Fatalf("SSHIdentityFiles = %v, %v; want [%s]", files, err, keyPath)
+	}
+	login, err := g.TestSSHHost(context.Background(), GitHubHost, "octocat")
+	if err != nil || login != "octocat" {
+		t.Fatalf("TestSSHHost = %q, %v; want octocat", login, err)
+	}
+
+	want := []Command{
+		{Name: "ssh", Args: []string{"-G", GitHubHost}, Timeout: sshConfigTimeout},
+		{Name: "ssh", Args: []string{"-T",
+			"-o", "StrictHostKeyChecking=yes",
+			"-o", "UserKnownHostsFile=" + knownHosts.Path(),
+			"-o", "GlobalKnownHostsFile=/dev/null",
+			"-o", "UpdateHostKeys=no",
+			"-o", "BatchMode=yes", "-o", "ConnectTimeout=10", "git@" + GitHubHost},
+			Timeout: sshTestTimeout},
+	}
+	calls := runner.Calls()
+	if !slices.EqualFunc(calls, want, func(a, b Command) bool {
+		return a.Name == b.Name && slices.Equal(a.Args, b.Args) && a.Timeout == b.Timeout
+	}) {
+		t.Errorf("ran\n%v\nwant\n%v", calls, want)
+	}
+
+	runner.Reset()
+	if calls := runner.Calls(); len(calls) != 0 {
+		t.Errorf("Reset kept %d calls", len(calls))
+	}
+}
+
+func TestValidateGitHubLogin(t *testing.T) {
+	tests := []struct {
+		login string
+		valid bool
+	}{
+		{"octocat", true},
+		{"jane-doe", true},
+		{"trailing-", true},
+		{"double--hyphen", true},
+		{"-leading", true},
+		{strings.Repeat("a", 39), true},
+		{strings.Repeat("a", 40), false},
+		{"", false},
+		{"jane_doe", false},
+		{"jane.doe", false},
+		{"org/repo", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateGitHubLogin(tt.login)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateGitHubLogin(%q) = %v, want valid %v", tt.login, err, tt.valid)
+		}
+	}
+}
+
+func TestAuthenticatedLogin(t *testing.T) {
+	tests := []struct {
+		output string
+		login  string
+		ok     bool
+	}{
+		{"Hi octocat! You've successfully authenticated, but GitHub does not provide shell access.", "octocat", true},
+		{"Hi old-name-! You've successfully authenticated, but GitHub does not provide shell access.", "old-name-", true},
+		{"Hi jane/dotfiles! You've successfully authenticated, but GitHub does not provide shell access.", "jane/dotfiles", true},
+		{"git@github.com: Permission denied (publickey).", "", false},
+	}
+
+	for _, tt := range tests {
+		login, ok := authenticatedLogin(tt.output)
+		if login != tt.login || ok != tt.ok {
+			t.Errorf("authenticatedLogin(%q) = %q, %v, want %q, %v", tt.output, login, ok, tt.login, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,927 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxIncludeDepth is how deep includes may nest, as in git
+const maxIncludeDepth = 10
+
+// GitConfig is a git config file. Every line is kept as it was read, so
+// writing the file back only changes the lines of edited variables and
+// keeps comments, indentation and the order of everything else.
+type GitConfig struct {
+	path  string
+	lines []*configLine
+	// resolved is set for a config merged from several files, e.g. from
+	// includes, which has no single file to be written to
+	resolved bool
+}
+
+type lineKind int
+
+const (
+	lineOther lineKind = iota // blank line or comment
+	lineSection
+	lineVariable
+)
+
+type configLine struct {
+	// raw is the line as in the file, including its line break. A section
+	// header followed by a variable on the same line is split in two.
+	raw  string
+	kind lineKind
+	// prefix is the lowercased section name, followed by a dot and the
+	// subsection if there is one
+	prefix string
+	// name is the lowercased variable name
+	name    string
+	value   string
+	noValue bool
+	// separator is the text between the name and the value, e.g. " = ",
+	// and comment the whitespace and comment after the value; both are
+	// kept when the value is replaced
+	separator string
+	comment   string
+}
+
+func (l *configLine) key() string {
+	// git reads variables before the first section without one
+	if l.prefix == "" {
+		return l.name
+	}
+	return l.prefix + "." + l.name
+}
+
+// GitConfigEntry is a variable of a git config file
+type GitConfigEntry struct {
+	// Key is the name git config --list shows: section and variable name
+	// lowercased, the subsection as written
+	Key   string
+	Value string
+	// NoValue is set for a variable without "=", which git reads as true
+	NoValue bool
+}
+
+func (e GitConfigEntry) String() string {
+	if e.NoValue {
+		return e.Key
+	}
+	return fmt.Sprintf("%s=%q", e.Key, e.Value)
+}
+
+// globalGitConfigPaths returns the files git reads in global scope, in the
+// order it reads them: $GIT_CONFIG_GLOBAL if set, else the XDG file and
+// then ~/.gitconfig, so values in ~/.gitconfig win
+func globalGitConfigPaths() []string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return []string{path}
+	}
+	xdgHome := os.Getenv("XDG_CONFIG_HOME")
+	if xdgHome == "" {
+		xdgHome = os.ExpandEnv("$HOME/.config")
+	}
+	return []string{filepath.Join(xdgHome, "git", "config"), os.ExpandEnv("$HOME/.gitconfig")}
+}
+
+// globalGitConfigPath is the file git config --global writes:
+// $GIT_CONFIG_GLOBAL if set, else ~/.gitconfig, unless only the XDG file
+// exists
+func globalGitConfigPath() string {
+	paths := globalGitConfigPaths()
+	path := paths[len(paths)-1]
+	if _, err := os.Stat(path); err == nil || len(paths) == 1 {
+		return path
+	}
+	if _, err := os.Stat(paths[0]); err == nil {
+		return paths[0]
+	}
+	return path
+}
+
+// readGlobalGitConfig reads the global git config file that is written to,
+// without following its includes
+func readGlobalGitConfig() (*GitConfig, error) {
+	return ReadGitConfig(globalGitConfigPath())
+}
+
+// readMergedGlobalGitConfig reads all files of the global git config into
+// one config that cannot be written, like git config --list shows them. With
+// includes the files they include unconditionally are read in too, as git
+// does when it looks up a value outside a repository.
+func readMergedGlobalGitConfig(includes bool) (*GitConfig, error) {
+	merged := &GitConfig{path: globalGitConfigPath(), resolved: true}
+	for _, path := range globalGitConfigPaths() {
+		cfg, err := ReadGitConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		if includes {
+			if cfg, err = cfg.Resolved(nil); err != nil {
+				return nil, err
+			}
+		}
+		merged.lines = append(merged.lines, cfg.lines...)
+	}
+	return merged, nil
+}
+
+// ReadGitConfig reads the git config file at path. A missing file is an
+// empty config that is created when written.
+func ReadGitConfig(path string) (*GitConfig, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &GitConfig{path: path}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git config: %w", err)
+	}
+	return ParseGitConfig(path, data)
+}
+
+// ParseGitConfig parses the content of a git config file; path is where it
+// is written to and where relative includes are resolved from
+func ParseGitConfig(path string, data []byte) (*GitConfig, error) {
+	p := &configParser{data: string(data), line: 1}
+	// git ignores a UTF-8 byte order mark
+	if strings.HasPrefix(p.data, "\ufeff") {
+		p.pos = len("\ufeff")
+	}
+
+	c := &GitConfig{path: path}
+	var prefix string
+	start := 0
+	emit := func(l *configLine) {
+		l.raw = p.data[start:p.pos]
+		c.lines = append(c.lines, l)
+		start = p.pos
+	}
+
+	for {
+		p.skipSpace()
+		if p.eof() {
+			if start < p.pos {
+				emit(&configLine{kind: lineOther})
+			}
+			return c, nil
+		}
+
+		line := p.line
+		switch ch := p.peek(); {
+		case ch == '\n':
+			p.next()
+			emit(&configLine{kind: lineOther})
+		case ch == '#' || ch == ';':
+			p.skipLine()
+			emit(&configLine{kind: lineOther})
+		case ch == '[':
+			p.next()
+			var ok bool
+			if prefix, ok = p.sectionHeader(); !ok {
+				return nil, fmt.Errorf("bad config line %d in file %s", line, path)
+			}
+			// a variable may follow on the same line
+			p.skipSpace()
+			if ch := p.peek(); p.eof() || ch == '\n' || ch == '#' || ch == ';' {
+				p.skipLine()
+			}
+			emit(&configLine{kind: lineSection, prefix: prefix})
+		case isAlpha(ch):
+			l, ok := p.variable()
+			if !ok {
+				return nil, fmt.Errorf("bad config line %d in file %s", line, path)
+			}
+			l.prefix = prefix
+			emit(l)
+		default:
+			return nil, fmt.Errorf("bad config line %d in file %s", line, path)
+		}
+	}
+}
+
+type configParser struct {
+	data string
+	pos  int
+	line int
+}
+
+func (p *configParser) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+// peek returns the next character without consuming it, reading a CRLF
+// line break as '\n'
+func (p *configParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	if p.data[p.pos] == '\r' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '\n' {
+		return '\n'
+	}
+	return p.data[p.pos]
+}
+
+// next consumes and returns the next character; 0 at the end of the data,
+// which ends a line like '\n'
+func (p *configParser) next() byte {
+	c := p.peek()
+	switch {
+	case p.eof():
+		return 0
+	case c == '\n' && p.data[p.pos] == '\r':
+		p.pos += 2
+	default:
+		p.pos++
+	}
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipSpace skips whitespace up to the end of the line
+func (p *configParser) skipSpace() {
+	for !p.eof() && isSpace(p.peek()) {
+		p.next()
+	}
+}
+
+// skipLine consumes the rest of the line including its line break
+func (p *configParser) skipLine() {
+	for !p.eof() && p.next() != '\n' {
+	}
+}
+
+// sectionHeader parses a header after its '[' and returns its prefix:
+// [section], [section "subsection"] or the deprecated [section.subsection]
+func (p *configParser) sectionHeader() (string, bool) {
+	var name strings.Builder
+	for {
+		c := p.next()
+		switch {
+		case c == ']':
+			if name.Len() == 0 {
+				return "", false
+			}
+			// the deprecated form is matched case-insensitively as a whole
+			return strings.ToLower(name.String()), true
+		case isSpace(c):
+			return p.subsection(strings.ToLower(name.String()))
+		case isAlnum(c) || c == '-' || c == '.':
+			name.WriteByte(c)
+		default:
+			return "", false
+		}
+	}
+}
+
+func (p *configParser) subsection(section string) (string, bool) {
+	p.skipSpace()
+	if section == "" || p.next() != '"' {
+		return "", false
+	}
+	var sub strings.Builder
+	for {
+		c := p.next()
+		switch c {
+		case 0, '\n':
+			return "", false
+		case '"':
+			if p.next() != ']' {
+				return "", false
+			}
+			return section + "." + sub.String(), true
+		case '\\':
+			c = p.next()
+			if c == 0 || c == '\n' {
+				return "", false
+			}
+		}
+		sub.WriteByte(c)
+	}
+}
+
+// variable parses "name = value" up to and including the line break
+func (p *configParser) variable() (*configLine, bool) {
+	l := &configLine{kind: lineVariable}
+	var name strings.Builder
+	for isAlnum(p.peek()) || p.peek() == '-' {
+		name.WriteByte(p.next())
+	}
+	l.name = strings.ToLower(name.String())
+
+	nameEnd := p.pos
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.next()
+	}
+	switch p.peek() {
+	case 0, '\n':
+		p.next()
+		l.noValue = true
+		return l, true
+	case '=':
+		p.next()
+	default:
+		return nil, false
+	}
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.next()
+	}
+	l.separator = p.data[nameEnd:p.pos]
+
+	var ok bool
+	l.value, l.comment, ok = p.value()
+	return l, ok
+}
+
+// value parses a variable's value like git: quotes group text, a backslash
+// escapes \, ", n, t and b or continues the line, comments start outside
+// quotes, and whitespace outside quotes is trimmed at the ends. It also
+// returns the comment after the value with the whitespace before it.
+func (p *configParser) value() (string, string, bool) {
+	var value strings.Builder
+	quoted, comment := false, false
+	spaces := 0
+	// valueEnd follows the last character of the value in the data
+	valueEnd, commentStart := p.pos, -1
+	for {
+		lineEnd := p.pos
+		c := p.next()
+		if c == 0 || c == '\n' {
+			if commentStart < 0 {
+				return value.String(), "", !quoted
+			}
+			return value.String(), p.data[commentStart:lineEnd], !quoted
+		}
+		if comment {
+			continue
+		}
+		if isSpace(c) && !quoted {
+			if value.Len() > 0 {
+				spaces++
+			}
+			continue
+		}
+		if !quoted && (c == '#' || c == ';') {
+			comment = true
+			commentStart = valueEnd
+			continue
+		}
+		valueEnd = p.pos
+		for ; spaces > 0; spaces-- {
+			value.WriteByte(' ')
+		}
+		switch c {
+		case '\\':
+			switch p.next() {
+			case 0, '\n':
+				valueEnd = p.pos
+				continue
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case 'b':
+				value.WriteByte('\b')
+			case '\\':
+				value.WriteByte('\\')
+			case '"':
+				value.WriteByte('"')
+			default:
+				return "", "", false
+			}
+			valueEnd = p.pos
+		case '"':
+			quoted = !quoted
+		default:
+			value.WriteByte(c)
+		}
+	}
+}
+
+// isSpace is git's notion of whitespace, without the line break
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isAlnum(c byte) bool {
+	return isAlpha(c) || c >= '0' && c <= '9'
+}
+
+// configKey is a key such as "user.name" or "includeIf.gitdir:~/w/.path"
+// split into its parts
+type configKey struct {
+	section    string
+	subsection string
+	name       string
+	hasSub     bool
+}
+
+func parseConfigKey(key string) (configKey, error) {
+	first, last := strings.Index(key, "."), strings.LastIndex(key, ".")
+	if first <= 0 || last == len(key)-1 {
+		return configKey{}, fmt.Errorf("invalid git config key %q", key)
+	}
+	k := configKey{section: key[:first], name: key[last+1:]}
+	if first != last {
+		k.subsection, k.hasSub = key[first+1:last], true
+	}
+
+	for i := 0; i < len(k.section); i++ {
+		if !isAlnum(k.section[i]) && k.section[i] != '-' {
+			return configKey{}, fmt.Errorf("invalid section in git config key %q", key)
+		}
+	}
+	if !isAlpha(k.name[0]) {
+		return configKey{}, fmt.Errorf("invalid variable name in git config key %q", key)
+	}
+	for i := 0; i < len(k.name); i++ {
+		if !isAlnum(k.name[i]) && k.name[i] != '-' {
+			return configKey{}, fmt.Errorf("invalid variable name in git config key %q", key)
+		}
+	}
+	if strings.Contains(k.subsection, "\n") {
+		return configKey{}, fmt.Errorf("invalid subsection in git config key %q", key)
+	}
+	return k, nil
+}
+
+func (k configKey) prefix() string {
+	if k.hasSub {
+		return strings.ToLower(k.section) + "." + k.subsection
+	}
+	return strings.ToLower(k.section)
+}
+
+func (k configKey) String() string {
+	return k.prefix() + "." + strings.ToLower(k.name)
+}
+
+// header formats the section header for a new section of the key, without
+// a line break
+func (k configKey) header() string {
+	if !k.hasSub {
+		return "[" + k.section + "]"
+	}
+	sub := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(k.subsection)
+	return "[" + k.section + ` "` + sub + `"]`
+}
+
+// formatConfigValue quotes and escapes value the way git config writes it
+func formatConfigValue(value string) string {
+	quote := strings.HasPrefix(value, " ") || strings.HasSuffix(value, " ") || strings.ContainsAny(value, "#;")
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(value)
+	if quote {
+		return `"` + escaped + `"`
+	}
+	return escaped
+}
+
+// Path is the file the config was read from and is written to
+func (c *GitConfig) Path() string {
+	return c.path
+}
+
+// Get returns the last value of key, which is the one git uses
+func (c *GitConfig) Get(key string) (string, bool) {
+	values := c.GetAll(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetAll returns every value of a multivar key, in order
+func (c *GitConfig) GetAll(key string) []string {
+	k, err := parseConfigKey(key)
+	if err != nil {
+		return nil
+	}
+	var values []string
+	for _, l := range c.lines {
+		if l.kind == lineVariable && l.key() == k.String() {
+			values = append(values, l.value)
+		}
+	}
+	return values
+}
+
+// Entries returns all variables in the order git reads them
+func (c *GitConfig) Entries() []GitConfigEntry {
+	var entries []GitConfigEntry
+	for _, l := range c.lines {
+		if l.kind == lineVariable {
+			entries = append(entries, GitConfigEntry{Key: l.key(), Value: l.value, NoValue: l.noValue})
+		}
+	}
+	return entries
+}
+
+// Set gives key the single value value, replacing its current value in
+// place or adding it to the end of its section. Like git config, it refuses
+// to replace the values of a multivar.
+func (c *GitConfig) Set(key, value string) error {
+	k, err := parseConfigKey(key)
+	if err != nil {
+		return err
+	}
+
+	var existing []*configLine
+	for _, l := range c.lines {
+		if l.kind == lineVariable && l.key() == k.String() {
+			existing = append(existing, l)
+		}
+	}
+	switch len(existing) {
+	case 0:
+		c.add(k, value)
+	case 1:
+		l := existing[0]
+		// keep the spelling, spacing and comment of the line
+		line := strings.TrimLeft(l.raw, " \t")
+		indent, name := l.raw[:len(l.raw)-len(line)], line[:len(l.name)]
+		if l.separator == "" {
+			l.separator = " = "
+		}
+		end := lineEnding(l.raw)
+		if end == "" {
+			end = c.lineBreak()
+		}
+		l.raw = indent + name + l.separator + formatConfigValue(value) + l.comment + end
+		l.value, l.noValue = value, false
+	default:
+		return fmt.Errorf("cannot overwrite the %d values of %s with a single value", len(existing), key)
+	}
+	return nil
+}
+
+// Add appends value to key, keeping its other values
+func (c *GitConfig) Add(key, value string) error {
+	k, err := parseConfigKey(key)
+	if err != nil {
+		return err
+	}
+	c.add(k, value)
+	return nil
+}
+
+// AddLast appends value to key at the very end of the file, in the last
+// section if it is one of the key's or else in a new section, so that no
+// other value follows it
+func (c *GitConfig) AddLast(key, value string) error {
+	k, err := parseConfigKey(key)
+	if err != nil {
+		return err
+	}
+	header := &configLine{raw: k.header() + c.lineBreak(), kind: lineSection, prefix: k.prefix()}
+	for i := len(c.lines) - 1; i >= 0; i-- {
+		if c.lines[i].kind == lineSection {
+			if c.lines[i].prefix == k.prefix() {
+				header = nil
+			}
+			break
+		}
+	}
+	c.endLine(len(c.lines) - 1)
+	if header != nil {
+		c.lines = append(c.lines, header)
+	}
+	c.lines = append(c.lines, c.variableLine(k, value))
+	return nil
+}
+
+// add inserts a variable after the last line of the last section of the
+// key, or in a new section at the end of the file. A new section goes before
+// the includeIf sections that end the file, so that it does not override
+// what they include: git lets later values win.
+func (c *GitConfig) add(k configKey, value string) {
+	line := c.variableLine(k, value)
+
+	at := -1
+	for i, l := range c.lines {
+		if (l.kind == lineSection || l.kind == lineVariable) && l.prefix == k.prefix() {
+			at = i
+		}
+	}
+	if at < 0 {
+		end := c.trailingIncludes()
+		if strings.HasPrefix(k.prefix(), "includeif.") {
+			end = len(c.lines)
+		}
+		c.endLine(end - 1)
+		header := &configLine{raw: k.header() + c.lineBreak(), kind: lineSection, prefix: k.prefix()}
+		c.lines = append(c.lines[:end], append([]*configLine{header, line}, c.lines[end:]...)...)
+		return
+	}
+
+	c.endLine(at)
+	c.lines = append(c.lines[:at+1], append([]*configLine{line}, c.lines[at+1:]...)...)
+}
+
+// variableLine formats a new line setting key to value
+func (c *GitConfig) variableLine(k configKey, value string) *configLine {
+	return &configLine{
+		raw:    "\t" + k.name + " = " + formatConfigValue(value) + c.lineBreak(),
+		kind:   lineVariable,
+		prefix: k.prefix(),
+		name:   strings.ToLower(k.name),
+		value:  value,
+	}
+}
+
+// trailingIncludes returns the index of the first line of the includeIf
+// sections that end the file, or the number of lines if the last section is
+// not one
+func (c *GitConfig) trailingIncludes() int {
+	start := len(c.lines)
+	for i := len(c.lines) - 1; i >= 0; i-- {
+		l := c.lines[i]
+		if l.kind != lineSection {
+			continue
+		}
+		if !strings.HasPrefix(l.prefix, "includeif.") {
+			break
+		}
+		start = i
+	}
+	return start
+}
+
+// endLine makes sure line i ends with a line break, so that a line can be
+// inserted after it
+func (c *GitConfig) endLine(i int) {
+	if i >= 0 && lineEnding(c.lines[i].raw) == "" {
+		c.lines[i].raw += c.lineBreak()
+	}
+}
+
+// lineBreak returns the line break the file uses, CRLF or LF
+func (c *GitConfig) lineBreak() string {
+	for _, l := range c.lines {
+		if end := lineEnding(l.raw); end != "" {
+			return end
+		}
+	}
+	return "\n"
+}
+
+// lineEnding returns the line break raw ends with, if any
+func lineEnding(raw string) string {
+	switch {
+	case strings.HasSuffix(raw, "\r\n"):
+		return "\r\n"
+	case strings.HasSuffix(raw, "\n"):
+		return "\n"
+	}
+	return ""
+}
+
+// Unset removes every value of key and returns how many there were
+func (c *GitConfig) Unset(key string) int {
+	return c.unset(key, func(string) bool { return true })
+}
+
+// UnsetValue removes the values of key that are exactly value and returns
+// how many there were
+func (c *GitConfig) UnsetValue(key, value string) int {
+	return c.unset(key, func(v string) bool { return v == value })
+}
+
+func (c *GitConfig) unset(key string, match func(value string) bool) int {
+	k, err := parseConfigKey(key)
+	if err != nil {
+		return 0
+	}
+
+	removed := 0
+	var kept []*configLine
+	for _, l := range c.lines {
+		if l.kind == lineVariable && l.key() == k.String() && match(l.value) {
+			removed++
+			// a header the variable shared its line with keeps the line break
+			if last := len(kept) - 1; last >= 0 && lineEnding(l.raw) != "" && lineEnding(kept[last].raw) == "" {
+				kept[last].raw = strings.TrimRight(kept[last].raw, " \t") + lineEnding(l.raw)
+			}
+			continue
+		}
+		kept = append(kept, l)
+	}
+	c.lines = kept
+	if removed > 0 {
+		c.removeEmptySections(k.prefix())
+	}
+	return removed
+}
+
+// removeEmptySections drops the headers of sections with the prefix that
+// have neither variables nor comments left, like git config --unset
+func (c *GitConfig) removeEmptySections(prefix string) {
+	var kept []*configLine
+	for i := 0; i < len(c.lines); i++ {
+		l := c.lines[i]
+		if l.kind == lineSection && l.prefix == prefix && c.sectionEmpty(i) {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	c.lines = kept
+}
+
+func (c *GitConfig) sectionEmpty(header int) bool {
+	for _, l := range c.lines[header+1:] {
+		if l.kind == lineSection {
+			break
+		}
+		if l.kind == lineVariable || strings.TrimSpace(l.raw) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Bytes returns the content of the file
+func (c *GitConfig) Bytes() []byte {
+	var b strings.Builder
+	for _, l := range c.lines {
+		b.WriteString(l.raw)
+	}
+	return []byte(b.String())
+}
+
+// Resolved returns the config with the files its include.path variables
+// point at read in where they appear, as git reads them. includeIf.*.path
+// variables are followed when match returns true for their condition, e.g.
+// "gitdir:~/work/"; a nil match follows none. Missing files are skipped.
+// The result cannot be written.
+func (c *GitConfig) Resolved(match func(condition string) bool) (*GitConfig, error) {
+	resolved := &GitConfig{path: c.path, resolved: true}
+	if err := c.resolveInto(resolved, match, 0); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+func (c *GitConfig) resolveInto(resolved *GitConfig, match func(string) bool, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("exceeded maximum include depth (%d) while including %s", maxIncludeDepth, c.path)
+	}
+
+	for _, l := range c.lines {
+		if l.kind != lineVariable {
+			continue
+		}
+		resolved.lines = append(resolved.lines, l)
+		if l.name != "path" || l.noValue || l.value == "" {
+			continue
+		}
+		include := l.prefix == "include"
+		if condition, ok := strings.CutPrefix(l.prefix, "includeif."); ok {
+			include = match != nil && match(condition)
+		}
+		if !include {
+			continue
+		}
+
+		included, err := ReadGitConfig(c.includePath(l.value))
+		if err != nil {
+			return err
+		}
+		if err := included.resolveInto(resolved, match, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// includePath resolves the path of an include like git: ~/ is the home
+// directory and relative paths start at the including file's directory
+func (c *GitConfig) includePath(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.ExpandEnv("$HOME"), path[2:])
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.Join(filepath.Dir(c.path), path)
+	}
+	return path
+}
+
+// Write saves the config to its file. Like git, it writes through the
+// file's ".lock" sibling, so it fails instead of racing a running git
+// config, and replaces the file atomically. A symlink is written through
+// to its target. Failures are a *ConfigWriteError.
+func (c *GitConfig) Write() error {
+	if c.resolved {
+		return fmt.Errorf("a git config merged from includes cannot be written")
+	}
+	if err := writeGitConfigFile(c.path, c.Bytes()); err != nil {
+		return &ConfigWriteError{Path: c.path, Err: err}
+	}
+	return nil
+}
+
+func writeGitConfigFile(path string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	lockPath := path + ".lock"
+	lock, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%w: %s exists; another git process seems to be running, or crashed and left it behind", ErrConfigLocked, lockPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			lock.Close()
+			os.Remove(lockPath)
+		}
+	}()
+
+	if _, err := lock.Write(data); err != nil {
+		return err
+	}
+	if err := lock.Sync(); err != nil {
+		return err
+	}
+	if err := lock.Chmod(mode); err != nil {
+		return err
+	}
+	if err := lock.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(lockPath, path); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// CompareGitConfigWithGit checks that git reads the global git config files
+// the same way as ghpm, variable by variable. git is asked for every variable
+// in global scope rather than for --global, which reads only one of the XDG
+// file and ~/.gitconfig. This interoperability check is all ghpm still runs
+// git itself for; without git it returns an error matching ErrGitNotFound.
+func (g *Manager) CompareGitConfigWithGit(ctx context.Context) error {
+	var files []string
+	for _, path := range globalGitConfigPaths() {
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	source := strings.Join(files, " and ")
+
+	cfg, err := readMergedGlobalGitConfig(false)
+	if err != nil {
+		return err
+	}
+
+	output, err := g.runGit(ctx, "config", "--list", "--null", "--show-scope", "--no-includes")
+	if err != nil {
+		return err
+	}
+	var fromGit []GitConfigEntry
+	items := strings.Split(string(output), "\x00")
+	for i := 0; i+1 < len(items); i += 2 {
+		if items[i] != "global" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(items[i+1], "\n")
+		fromGit = append(fromGit, GitConfigEntry{Key: key, Value: value, NoValue: !hasValue})
+	}
+
+	ours := cfg.Entries()
+	for i := 0; i < max(len(ours), len(fromGit)); i++ {
+		switch {
+		case i >= len(ours):
+			return fmt.Errorf("git reads %s from %s, ghpm does not", fromGit[i], source)
+		case i >= len(fromGit):
+			return fmt.Errorf("ghpm reads %s from %s, git does not", ours[i], source)
+		case ours[i] != fromGit[i]:
+			return fmt.Errorf("git reads %s from %s, ghpm reads %s", fromGit[i], source, ours[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,582 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGitConfigRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"comments and blank lines", "# top\n\n; other\n[user]\n\t# inside\n\tname = Jane\n\n"},
+		{"no final line break", "[user]\n\tname = Jane"},
+		{"CRLF", "[user]\r\n\tname = Jane\r\n\temail = jane@example.com ; work\r\n"},
+		{"quoted subsection", "[includeIf \"gitdir:~/work/\"]\n\tpath = ~/.ghpm/includes/work.gitconfig\n"},
+		{"escaped subsection", "[url \"a\\\"b\\\\c\"]\n\tinsteadOf = x\n"},
+		{"deprecated subsection", "[Section.Sub]\n\tkey = value\n"},
+		{"header and variable on one line", "[user] name = Jane\n[core]\tpager = less # paged\n"},
+		{"continuation", "[alias]\n\tlg = log \\\n\t  --oneline \\\n\t  --graph\n"},
+		{"quotes and escapes", "[alias]\n\tsay = \"!echo \\\"hi\\\"; true\"\n\tq = \" padded \"\n"},
+		{"no value", "[core]\n\tbare\n\tfilemode\n"},
+		{"odd spacing", "  [user]  \n   name=Jane   \n\temail\t=\tjane@example.com\t# c\n"},
+		{"variable before any section", "name = top\n[user]\n\tname = Jane\n"},
+		{"byte order mark", "\ufeff[user]\n\tname = Jane\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseGitConfig("/home/u/.gitconfig", []byte(tt.input))
+			if err != nil {
+				t.Fatalf("ParseGitConfig: %v", err)
+			}
+			if got := string(cfg.Bytes()); got != tt.input {
+				t.Errorf("round trip changed the file:\ngot  %q\nwant %q", got, tt.input)
+			}
+		})
+	}
+}
+
+func TestGitConfigParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []GitConfigEntry
+	}{
+		{
+			name:  "inline comments",
+			input: "[user]\n\tname = Jane Doe # full name\n\temail = jane@example.com;work\n",
+			want:  []GitConfigEntry{{Key: "user.name", Value: "Jane Doe"}, {Key: "user.email", Value: "jane@example.com"}},
+		},
+		{
+			name:  "quoted comment characters",
+			input: "[alias]\n\tsay = \"!echo #1; true\" # real comment\n",
+			want:  []GitConfigEntry{{Key: "alias.say", Value: "!echo #1; true"}},
+		},
+		{
+			name:  "continuation",
+			input: "[alias]\n\tlg = log \\\n  --oneline\n",
+			want:  []GitConfigEntry{{Key: "alias.lg", Value: "log   --oneline"}},
+		},
+		{
+			name:  "escapes",
+			input: "[a]\n\tb = \"x\\ty\\nz\\\\\"\n",
+			want:  []GitConfigEntry{{Key: "a.b", Value: "x\ty\nz\\"}},
+		},
+		{
+			name:  "CRLF",
+			input: "[user]\r\n\tname = Jane\r\n",
+			want:  []GitConfigEntry{{Key: "user.name", Value: "Jane"}},
+		},
+		{
+			name:  "quoted subsection keeps its case",
+			input: "[includeIf \"gitdir:~/Work/\"]\n\tPath = w.gitconfig\n",
+			want:  []GitConfigEntry{{Key: "includeif.gitdir:~/Work/.path", Value: "w.gitconfig"}},
+		},
+		{
+			name:  "deprecated subsection is lowercased",
+			input: "[Section.Sub]\n\tkey = v\n",
+			want:  []GitConfigEntry{{Key: "section.sub.key", Value: "v"}},
+		},
+		{
+			name:  "header and variable on one line",
+			input: "[user] name = Jane\n",
+			want:  []GitConfigEntry{{Key: "user.name", Value: "Jane"}},
+		},
+		{
+			name:  "no value",
+			input: "[core]\n\tbare\n",
+			want:  []GitConfigEntry{{Key: "core.bare", NoValue: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseGitConfig("/home/u/.gitconfig", []byte(tt.input))
+			if err != nil {
+				t.Fatalf("ParseGitConfig: %v", err)
+			}
+			if got := cfg.Entries(); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitConfigParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"[user\n\tname = Jane\n",
+		"[user \"unterminated]\n",
+		"[user]\n\tname = \"unterminated\n",
+		"[user]\n\tname = bad \\q escape\n",
+		"[user]\n\t1name = Jane\n",
+	} {
+		if _, err := ParseGitConfig("/home/u/.gitconfig", []byte(input)); err == nil {
+			t.Errorf("ParseGitConfig(%q) succeeded, want an error", input)
+		}
+	}
+}
+
+func TestGitConfigEdit(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		edit    func(c *GitConfig) error
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "set keeps layout and comment",
+			input: "# mine\n[user]\n    name  =  Old # who\n\temail = old@example.com\n[core]\n\tpager = less\n",
+			edit:  func(c *GitConfig) error { return c.Set("user.name", "New Name") },
+			want:  "# mine\n[user]\n    name  =  New Name # who\n\temail = old@example.com\n[core]\n\tpager = less\n",
+		},
+		{
+			name:  "set adds to the end of the section",
+			input: "[user]\n\tname = Jane\n[core]\n\tpager = less\n",
+			edit:  func(c *GitConfig) error { return c.Set("user.email", "jane@example.com") },
+			want:  "[user]\n\tname = Jane\n\temail = jane@example.com\n[core]\n\tpager = less\n",
+		},
+		{
+			name:  "set adds a section",
+			input: "[core]\n\tpager = less",
+			edit:  func(c *GitConfig) error { return c.Set("user.name", "Jane") },
+			want:  "[core]\n\tpager = less\n[user]\n\tname = Jane\n",
+		},
+		{
+			name:  "set adds a section before the includeIf sections that end the file",
+			input: "[core]\n\tpager = less\n[includeIf \"gitdir:~/work/\"]\n\tpath = w.gitconfig\n[includeIf \"gitdir:~/oss/\"] path = o.gitconfig",
+			edit:  func(c *GitConfig) error { return c.Set("user.name", "Jane") },
+			want:  "[core]\n\tpager = less\n[user]\n\tname = Jane\n[includeIf \"gitdir:~/work/\"]\n\tpath = w.gitconfig\n[includeIf \"gitdir:~/oss/\"] path = o.gitconfig",
+		},
+		{
+			name:  "add of an includeIf still goes to the end",
+			input: "[includeIf \"gitdir:~/work/\"]\n\tpath = w.gitconfig\n",
+			edit:  func(c *GitConfig) error { return c.Add("includeIf.gitdir:~/oss/.path", "o.gitconfig") },
+			want:  "[includeIf \"gitdir:~/work/\"]\n\tpath = w.gitconfig\n[includeIf \"gitdir:~/oss/\"]\n\tpath = o.gitconfig\n",
+		},
+		{
+			name:  "add last starts a section after the others",
+			input: "[includeIf \"gitdir:~/work/\"]\n\tpath = w.gitconfig\n[user]\n\tname = Jane",
+			edit:  func(c *GitConfig) error { return c.AddLast("includeIf.gitdir:~/work/.path", "w2.gitconfig") },
+			want:  "[includeIf \"gitdir:~/work/\"]\n\tpath = w.gitconfig\n[user]\n\tname = Jane\n[includeIf \"gitdir:~/work/\"]\n\tpath = w2.gitconfig\n",
+		},
+		{
+			name:  "add last extends the last section",
+			input: "[user]\n\tname = Jane\n[includeIf \"gitdir:~/work/\"]\n\tpath = w.gitconfig\n",
+			edit:  func(c *GitConfig) error { return c.AddLast("includeIf.gitdir:~/work/.path", "w2.gitconfig") },
+			want:  "[user]\n\tname = Jane\n[includeIf \"gitdir:~/work/\"]\n\tpath = w.gitconfig\n\tpath = w2.gitconfig\n",
+		},
+		{
+			name:  "set quotes values git would misread",
+			input: "",
+			edit:  func(c *GitConfig) error { return c.Set("alias.x", ` !echo "a#b"`) },
+			want:  "[alias]\n\tx = \" !echo \\\"a#b\\\"\"\n",
+		},
+		{
+			name:  "set replaces a continued value",
+			input: "[alias]\n\tlg = log \\\n\t  --oneline\n[core]\n\tpager = less\n",
+			edit:  func(c *GitConfig) error { return c.Set("alias.lg", "log --graph") },
+			want:  "[alias]\n\tlg = log --graph\n[core]\n\tpager = less\n",
+		},
+		{
+			name:  "set on a header and variable on one line",
+			input: "[user] name = Old\n",
+			edit:  func(c *GitConfig) error { return c.Set("user.name", "New") },
+			want:  "[user] name = New\n",
+		},
+		{
+			name:  "set in a quoted subsection",
+			input: "[includeIf \"gitdir:~/work/\"]\n\tpath = old.gitconfig\n",
+			edit:  func(c *GitConfig) error { return c.Set("includeIf.gitdir:~/work/.path", "new.gitconfig") },
+			want:  "[includeIf \"gitdir:~/work/\"]\n\tpath = new.gitconfig\n",
+		},
+		{
+			name:  "set adds a quoted subsection",
+			input: "[user]\n\tname = Jane\n",
+			edit:  func(c *GitConfig) error { return c.Set(`url.git@github.com-work:.insteadOf`, "https://github.com/work/") },
+			want:  "[user]\n\tname = Jane\n[url \"git@github.com-work:\"]\n\tinsteadOf = https://github.com/work/\n",
+		},
+		{
+			name:  "set keeps CRLF",
+			input: "[user]\r\n\tname = Old ; me\r\n",
+			edit: func(c *GitConfig) error {
+				if err := c.Set("user.name", "New"); err != nil {
+					return err
+				}
+				return c.Set("core.pager", "less")
+			},
+			want: "[user]\r\n\tname = New ; me\r\n[core]\r\n\tpager = less\r\n",
+		},
+		{
+			name:    "set refuses a multivar",
+			input:   "[remote \"origin\"]\n\tfetch = a\n\tfetch = b\n",
+			edit:    func(c *GitConfig) error { return c.Set("remote.origin.fetch", "c") },
+			want:    "[remote \"origin\"]\n\tfetch = a\n\tfetch = b\n",
+			wantErr: true,
+		},
+		{
+			name:  "add appends to a multivar",
+			input: "[remote \"origin\"]\n\tfetch = a\n\turl = u\n[core]\n\tpager = less\n",
+			edit:  func(c *GitConfig) error { return c.Add("remote.origin.fetch", "b") },
+			want:  "[remote \"origin\"]\n\tfetch = a\n\turl = u\n\tfetch = b\n[core]\n\tpager = less\n",
+		},
+		{
+			name:  "add goes to the last section of the key",
+			input: "[user]\n\tname = a\n[core]\n\tpager = less\n[user]\n\temail = e\n",
+			edit:  func(c *GitConfig) error { return c.Add("user.name", "b") },
+			want:  "[user]\n\tname = a\n[core]\n\tpager = less\n[user]\n\temail = e\n\tname = b\n",
+		},
+		{
+			name:  "unset removes every value and the empty section",
+			input: "[core]\n\tpager = less\n[remote \"origin\"]\n\tfetch = a # one\n\tfetch = b\n[user]\n\tname = Jane\n",
+			edit:  unsetWant("remote.origin.fetch", "", 2),
+			want:  "[core]\n\tpager = less\n[user]\n\tname = Jane\n",
+		},
+		{
+			name:  "unset keeps a section with comments",
+			input: "[user]\n\t# keep me\n\tname = Jane\n",
+			edit:  unsetWant("user.name", "", 1),
+			want:  "[user]\n\t# keep me\n",
+		},
+		{
+			name:  "unset a variable on its header's line",
+			input: "[user] name = Jane\n\temail = e\n",
+			edit:  unsetWant("user.name", "", 1),
+			want:  "[user]\n\temail = e\n",
+		},
+		{
+			name:  "unset a continued value",
+			input: "[alias]\n\tlg = log \\\n\t  --oneline\n\tst = status\n",
+			edit:  unsetWant("alias.lg", "", 1),
+			want:  "[alias]\n\tst = status\n",
+		},
+		{
+			name:  "unset in CRLF",
+			input: "[user] name = Jane\r\n\temail = e\r\n",
+			edit:  unsetWant("user.name", "", 1),
+			want:  "[user]\r\n\temail = e\r\n",
+		},
+		{
+			name:  "unset a missing key",
+			input: "[user]\n\tname = Jane\n",
+			edit:  unsetWant("user.email", "", 0),
+			want:  "[user]\n\tname = Jane\n",
+		},
+		{
+			name:  "unset value removes one value of a multivar",
+			input: "[include]\n\tpath = a\n\tpath = b\n\tpath = c\n",
+			edit:  unsetWant("include.path", "b", 1),
+			want:  "[include]\n\tpath = a\n\tpath = c\n",
+		},
+		{
+			name:  "unset value matches the parsed value",
+			input: "[includeIf \"gitdir:~/w/\"]\n\tpath = \"~/a b\" # quoted\n\tpath = ~/c\n",
+			edit:  unsetWant("includeIf.gitdir:~/w/.path", "~/a b", 1),
+			want:  "[includeIf \"gitdir:~/w/\"]\n\tpath = ~/c\n",
+		},
+		{
+			name:  "unset value of the last value drops the section",
+			input: "[include]\n\tpath = a\n[user]\n\tname = Jane\n",
+			edit:  unsetWant("include.path", "a", 1),
+			want:  "[user]\n\tname = Jane\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseGitConfig("/home/u/.gitconfig", []byte(tt.input))
+			if err != nil {
+				t.Fatalf("ParseGitConfig: %v", err)
+			}
+			err = tt.edit(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("edit: got error %v, want error %v", err, tt.wantErr)
+			}
+			if got := string(cfg.Bytes()); got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+
+			// the edited file reads back as it is kept in memory
+			reread, err := ParseGitConfig("/home/u/.gitconfig", cfg.Bytes())
+			if err != nil {
+				t.Fatalf("the edited file does not parse: %v", err)
+			}
+			if !slices.Equal(reread.Entries(), cfg.Entries()) {
+				t.Errorf("read back as %v, kept as %v", reread.Entries(), cfg.Entries())
+			}
+		})
+	}
+}
+
+// unsetWant unsets key, or only its value if value is set, and checks that
+// count values were removed
+func unsetWant(key, value string, count int) func(c *GitConfig) error {
+	return func(c *GitConfig) error {
+		removed := 0
+		if value == "" {
+			removed = c.Unset(key)
+		} else {
+			removed = c.UnsetValue(key, value)
+		}
+		if removed != count {
+			return fmt.Errorf("removed %d values of %s, want %d", removed, key, count)
+		}
+		return nil
+	}
+}
+
+// writeIncludeChain writes n files in dir that each include the next and
+// returns the path of the first; the last one sets user.name
+func writeIncludeChain(t *testing.T, dir string, n int) string {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		content := fmt.Sprintf("[include]\n\tpath = %d.gitconfig\n", i+1)
+		if i == n-1 {
+			content = "[user]\n\tname = Deep\n"
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.gitconfig", i)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "0.gitconfig")
+}
+
+func TestGitConfigResolvedDepth(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   int
+		wantErr bool
+	}{
+		{"no include", 1, false},
+		{"one level", 2, false},
+		{"maximum depth", maxIncludeDepth + 1, false},
+		{"too deep", maxIncludeDepth + 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ReadGitConfig(writeIncludeChain(t, t.TempDir(), tt.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resolved, err := cfg.Resolved(nil)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "maximum include depth") {
+					t.Fatalf("Resolved: got %v, want a depth error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolved: %v", err)
+			}
+			if name, _ := resolved.Get("user.name"); name != "Deep" {
+				t.Errorf("user.name = %q, want the value of the deepest file", name)
+			}
+		})
+	}
+}
+
+func TestGitConfigResolvedCycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "self.gitconfig")
+	if err := os.WriteFile(path, []byte("[include]\n\tpath = self.gitconfig\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ReadGitConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.Resolved(nil); err == nil {
+		t.Fatal("Resolved of a file including itself succeeded")
+	}
+}
+
+func TestGitConfigResolvedOrder(t *testing.T) {
+	home := useTempHome(t)
+	files := map[string]string{
+		".gitconfig": "[user]\n\tname = Before\n[include]\n\tpath = ~/inc/a.gitconfig\n" +
+			"[includeIf \"gitdir:~/work/\"]\n\tpath = inc/work.gitconfig\n" +
+			"[include]\n\tpath = missing.gitconfig\n[user]\n\temail = after@example.com\n",
+		"inc/a.gitconfig":    "[user]\n\tname = Included\n\temail = included@example.com\n",
+		"inc/work.gitconfig": "[user]\n\tname = Work\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(home, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := ReadGitConfig(filepath.Join(home, ".gitconfig"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		match     func(string) bool
+		wantName  string
+		wantEmail string
+	}{
+		{"unconditional includes only", nil, "Included", "after@example.com"},
+		{"matching condition", func(c string) bool { return c == "gitdir:~/work/" }, "Work", "after@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := cfg.Resolved(tt.match)
+			if err != nil {
+				t.Fatalf("Resolved: %v", err)
+			}
+			name, _ := resolved.Get("user.name")
+			email, _ := resolved.Get("user.email")
+			if name != tt.wantName || email != tt.wantEmail {
+				t.Errorf("got %s <%s>, want %s <%s>", name, email, tt.wantName, tt.wantEmail)
+			}
+			if err := resolved.Write(); err == nil {
+				t.Error("a resolved config was written")
+			}
+		})
+	}
+}
+
+func TestGlobalGitConfigFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		xdg       string
+		home      string
+		wantPath  string
+		wantName  string
+		wantEmail string
+	}{
+		{
+			name:      "both files, ~/.gitconfig wins",
+			xdg:       "[user]\n\tname = Xdg\n\temail = xdg@example.com\n",
+			home:      "[user]\n\tname = Home\n",
+			wantPath:  ".gitconfig",
+			wantName:  "Home",
+			wantEmail: "xdg@example.com",
+		},
+		{
+			name:      "only the XDG file",
+			xdg:       "[user]\n\tname = Xdg\n\temail = xdg@example.com\n",
+			wantPath:  ".config/git/config",
+			wantName:  "Xdg",
+			wantEmail: "xdg@example.com",
+		},
+		{
+			name:      "only ~/.gitconfig",
+			home:      "[user]\n\tname = Home\n\temail = home@example.com\n",
+			wantPath:  ".gitconfig",
+			wantName:  "Home",
+			wantEmail: "home@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := useTempHome(t)
+			for path, content := range map[string]string{".config/git/config": tt.xdg, ".gitconfig": tt.home} {
+				if content == "" {
+					continue
+				}
+				path = filepath.Join(home, path)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got, want := globalGitConfigPath(), filepath.Join(home, tt.wantPath); got != want {
+				t.Errorf("writes to %s, want %s", got, want)
+			}
+			name, email, err := NewManagerWithRunner(NewFakeRunner()).GetCurrentGitConfig()
+			if err != nil {
+				t.Fatalf("GetCurrentGitConfig: %v", err)
+			}
+			if name != tt.wantName || email != tt.wantEmail {
+				t.Errorf("got %s <%s>, want %s <%s>", name, email, tt.wantName, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestCompareGitConfigWithGit(t *testing.T) {
+	home := useTempHome(t)
+	xdg := filepath.Join(home, ".config", "git", "config")
+	if err := os.MkdirAll(filepath.Dir(xdg), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(xdg, []byte("[core]\n\tpager = less\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[user]\n\tname = Jane\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		list    string
+		wantErr string
+	}{
+		{"same reading", "global\x00core.pager\nless\x00global\x00user.name\nJane\x00", ""},
+		{"other scopes ignored", "system\x00core.editor\nvi\x00global\x00core.pager\nless\x00global\x00user.name\nJane\x00local\x00user.name\nJo\x00", ""},
+		{"git misses the XDG file", "global\x00user.name\nJane\x00", "ghpm reads"},
+		{"different value", "global\x00core.pager\nless\x00global\x00user.name\nJohn\x00", `git reads user.name="John"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewFakeRunner()
+			runner.Respond(FakeResponse{Output: Output{Stdout: []byte(tt.list)}}, "git", "config", "--list")
+			err := NewManagerWithRunner(runner).CompareGitConfigWithGit(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CompareGitConfigWithGit: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetGitConfigKeepsBindingsLast(t *testing.T) {
+	for _, tt := range bindingTests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := useTempHome(t)
+			if resolved, err := filepath.EvalSymlinks(home); err == nil {
+				home = resolved
+			}
+			g := NewManager()
+			repo, condition := tt.bind(t, home)
+			ownedDir, includes := setUpBinding(t, g, home, condition)
+			if err := g.SyncConditionalIncludes(ownedDir, includes); err != nil {
+				t.Fatal(err)
+			}
+
+			// no [user] section yet, so setGitConfig adds one
+			if err := g.setGitConfig("Global User", "global@example.com"); err != nil {
+				t.Fatalf("setGitConfig: %v", err)
+			}
+			if got := runRealGit(t, repo, "config", "user.name"); got != "Bound User" {
+				t.Errorf("git config user.name in the bound repository = %q, want %q", got, "Bound User")
+			}
+			if got := runRealGit(t, home, "config", "user.name"); got != "Global User" {
+				t.Errorf("git config user.name outside it = %q, want %q", got, "Global User")
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ConditionalInclude is an includeIf entry in the global git config
+type ConditionalInclude struct {
+	Condition string // e.g. "gitdir:~/work/"
+	Path      string // include file the condition points at
+}
+
+// GitdirCondition returns the includeIf condition matching every repository
+// below dir. A trailing slash makes git match the whole tree.
+func GitdirCondition(dir string) string {
+	dir = filepath.ToSlash(strings.TrimSpace(dir))
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	return "gitdir:" + dir
+}
+
+// RemoteURLCondition returns the includeIf condition matching repositories
+// with any remote whose URL matches pattern (e.g. "git@github.com:acme/**")
+func RemoteURLCondition(pattern string) string {
+	return "hasconfig:remote.*.url:" + strings.TrimSpace(pattern)
+}
+
+// ValidateRemoteURLPattern checks that pattern can be used in a
+// hasconfig:remote.*.url condition of the global git config
+func ValidateRemoteURLPattern(pattern string) error {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return fmt.Errorf("remote URL pattern cannot be empty")
+	}
+	if strings.ContainsAny(pattern, "\n\r\" \t") {
+		return fmt.Errorf("remote URL pattern %q contains invalid characters", pattern)
+	}
+	return nil
+}
+
+// ValidateIncludeDirectory checks that dir can be used in a gitdir condition
+// of the global git config
+func ValidateIncludeDirectory(dir string) error {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return fmt.Errorf("directory cannot be empty")
+	}
+	if strings.ContainsAny(dir, "\n\r\"") {
+		return fmt.Errorf("directory %q contains invalid characters", dir)
+	}
+	if !strings.HasPrefix(dir, "~/") && !filepath.IsAbs(dir) {
+		return fmt.Errorf("directory %q must be absolute or start with ~/", dir)
+	}
+	return nil
+}
+
+// WriteIncludeFile (re)creates a git config file setting the identity and,
+// when sshKeyPath is not empty, the SSH command used inside matching repositories
+func (g *Manager) WriteIncludeFile(path, username, email, sshKeyPath string) error {
+	if err := ValidateGitInput(username, email); err != nil {
+		return fmt.Errorf("invalid git configuration: %w", err)
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace include file: %w", err)
+	}
+
+	values := [][2]string{
+		{"user.name", username},
+		{"user.email", email},
+	}
+	if sshKeyPath != "" {
+		values = append(values, [2]string{"core.sshCommand", sshCommandForKey(sshKeyPath)})
+	}
+
+	cfg := &GitConfig{path: path}
+	for _, kv := range values {
+		if err := cfg.Set(kv[0], kv[1]); err != nil {
+			return fmt.Errorf("failed to set %s in include file: %w", kv[0], err)
+		}
+	}
+	if err := cfg.Write(); err != nil {
+		return err
+	}
+
+	return os.Chmod(path, 0600)
+}
+
+// SyncConditionalIncludes makes the includeIf entries of the global git config
+// that point into ownedDir match includes exactly, in order, and keeps them at
+// the end of the file; git lets the last value win, so an identity set after
+// them would override every binding. Entries pointing anywhere else are never
+// touched.
+func (g *Manager) SyncConditionalIncludes(ownedDir string, includes []ConditionalInclude) error {
+	cfg, err := readGlobalGitConfig()
+	if err != nil {
+		return err
+	}
+
+	var owned []ConditionalInclude
+	last := true
+	for _, entry := range cfg.Entries() {
+		inc, ok := conditionalInclude(entry)
+		if ok && isWithinDir(ownedDir, inc.Path) {
+			owned = append(owned, inc)
+			last = true
+		} else if len(owned) > 0 {
+			last = false
+		}
+	}
+
+	if slices.Equal(owned, includes) && last {
+		return nil
+	}
+
+	for _, inc := range owned {
+		cfg.UnsetValue("includeIf."+inc.Condition+".path", inc.Path)
+	}
+
+	for _, inc := range includes {
+		if err := cfg.AddLast("includeIf."+inc.Condition+".path", inc.Path); err != nil {
+			return fmt.Errorf("failed to add includeIf %q: %w", inc.Condition, err)
+		}
+	}
+
+	return cfg.Write()
+}
+
+// conditionalInclude returns the includeIf entry entry sets, if it is one
+func conditionalInclude(entry GitConfigEntry) (ConditionalInclude, bool) {
+	// the key is "includeif.<condition>.path"
+	condition, ok := strings.CutPrefix(entry.Key, "includeif.")
+	if !ok || !strings.HasSuffix(condition, ".path") || entry.NoValue {
+		return ConditionalInclude{}, false
+	}
+	return ConditionalInclude{Condition: strings.TrimSuffix(condition, ".path"), Path: entry.Value}, true
+}
+
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
@@ -0,0 +1,117 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// runRealGit runs the installed git in dir, reading only the global config
+// of the test's HOME, and returns its trimmed output
+func runRealGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	// an empty GIT_CONFIG_GLOBAL, as useTempHome sets it, would hide ~/.gitconfig
+	cmd.Env = slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		return strings.HasPrefix(kv, "GIT_CONFIG_GLOBAL=")
+	})
+	cmd.Env = append(cmd.Env, "GIT_CONFIG_NOSYSTEM=1")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// bindingTest sets up a repository bound to the "Bound User" identity
+type bindingTest struct {
+	name string
+	// bind creates the repository below home and returns it with the
+	// condition that binds it
+	bind func(t *testing.T, home string) (repo, condition string)
+}
+
+var bindingTests = []bindingTest{
+	{
+		name: "directory",
+		bind: func(t *testing.T, home string) (string, string) {
+			repo := filepath.Join(home, "work", "repo")
+			runRealGit(t, home, "init", "-q", repo)
+			return repo, GitdirCondition(filepath.Join(home, "work"))
+		},
+	},
+	{
+		name: "remote URL",
+		bind: func(t *testing.T, home string) (string, string) {
+			repo := filepath.Join(home, "acme")
+			runRealGit(t, home, "init", "-q", repo)
+			runRealGit(t, repo, "remote", "add", "origin", "git@github.com:acme/tool.git")
+			return repo, RemoteURLCondition("git@github.com:acme/**")
+		},
+	},
+}
+
+// setUpBinding writes the include file of the bound identity and returns
+// the includes ghpm owns for it
+func setUpBinding(t *testing.T, g *Manager, home, condition string) (string, []ConditionalInclude) {
+	t.Helper()
+	ownedDir := filepath.Join(home, ".config", "ghpm", "includes")
+	if err := os.MkdirAll(ownedDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	includePath := filepath.Join(ownedDir, "bound.gitconfig")
+	if err := g.WriteIncludeFile(includePath, "Bound User", "bound@example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	return ownedDir, []ConditionalInclude{{Condition: condition, Path: includePath}}
+}
+
+func TestSyncConditionalIncludesKeepsBindingsLast(t *testing.T) {
+	for _, tt := range bindingTests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := useTempHome(t)
+			if resolved, err := filepath.EvalSymlinks(home); err == nil {
+				home = resolved
+			}
+			g := NewManager()
+			repo, condition := tt.bind(t, home)
+			ownedDir, includes := setUpBinding(t, g, home, condition)
+
+			// an identity added after the binding, as an older ghpm did
+			gitConfigPath := filepath.Join(home, ".gitconfig")
+			content := "[includeIf \"" + condition + "\"]\n\tpath = " + includes[0].Path + "\n" +
+				"[user]\n\tname = Global User\n\temail = global@example.com\n"
+			if err := os.WriteFile(gitConfigPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := g.SyncConditionalIncludes(ownedDir, includes); err != nil {
+				t.Fatalf("SyncConditionalIncludes: %v", err)
+			}
+			if got := runRealGit(t, repo, "config", "user.name"); got != "Bound User" {
+				t.Errorf("git config user.name in the bound repository = %q, want %q", got, "Bound User")
+			}
+			if got := runRealGit(t, home, "config", "user.name"); got != "Global User" {
+				t.Errorf("git config user.name outside it = %q, want %q", got, "Global User")
+			}
+
+			synced, err := os.ReadFile(gitConfigPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := g.SyncConditionalIncludes(ownedDir, includes); err != nil {
+				t.Fatalf("SyncConditionalIncludes: %v", err)
+			}
+			if again, _ := os.ReadFile(gitConfigPath); string(again) != string(synced) {
+				t.Errorf("a second sync changed the file:\n%q\nto\n%q", synced, again)
+			}
+		})
+	}
+}
@@ -5,6 +5,23 @@ type ProfileInterface interface {
 	GetName() string
 	GetGitUsername() string
 	GetGitEmail() string
+	// GetGitHubLogin is the account the profile's key should belong to, or
+	// empty if it is not known
+	GetGitHubLogin() string
 	HasSSHKeys() bool
-	WriteSSHKeysToSystem() error
+	// GetSSHPrivateKey may have to load the key from a secret backend
+	GetSSHPrivateKey() (string, error)
+	WriteSSHKeysToSystem(strategy SSHKeyStrategy) error
+	// SSHFilePaths lists every file WriteSSHKeysToSystem may change
+	SSHFilePaths() []string
+}
+
+// ExecProfileInterface defines what running a single command under a
+// profile's identity needs from a profile
+type ExecProfileInterface interface {
+	GetName() string
+	GetGitUsername() string
+	GetGitEmail() string
+	HasSSHKeys() bool
+	WriteSSHKeysToTempDir() (string, func(), error)
 }
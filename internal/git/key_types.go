@@ -0,0 +1,85 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyType describes an SSH key algorithm ghpm supports
+type KeyType struct {
+	// Algorithm is the key type as written in a public key
+	Algorithm string
+	// Name is shown to the user
+	Name string
+	// FileName is the file ssh-keygen writes such a key to in ~/.ssh; the
+	// public key is FileName + ".pub"
+	FileName string
+	// Label is the short name ssh-keygen prints for the type
+	Label string
+	// Bits is the key size, or 0 for RSA where it depends on the key
+	Bits int
+	// SecurityKey is set for FIDO keys, whose private half stays on the
+	// hardware token
+	SecurityKey bool
+}
+
+// KeyTypes lists the supported key types, in the order key files are
+// looked for in ~/.ssh
+var KeyTypes = []KeyType{
+	{Algorithm: ssh.KeyAlgoED25519, Name: "Ed25519", FileName: "id_ed25519", Label: "ED25519", Bits: 256},
+	{Algorithm: ssh.KeyAlgoSKED25519, Name: "Ed25519 security key", FileName: "id_ed25519_sk", Label: "ED25519-SK", Bits: 256, SecurityKey: true},
+	{Algorithm: ssh.KeyAlgoECDSA256, Name: "ECDSA P-256", FileName: "id_ecdsa", Label: "ECDSA", Bits: 256},
+	{Algorithm: ssh.KeyAlgoECDSA384, Name: "ECDSA P-384", FileName: "id_ecdsa", Label: "ECDSA", Bits: 384},
+	{Algorithm: ssh.KeyAlgoECDSA521, Name: "ECDSA P-521", FileName: "id_ecdsa", Label: "ECDSA", Bits: 521},
+	{Algorithm: ssh.KeyAlgoSKECDSA256, Name: "ECDSA P-256 security key", FileName: "id_ecdsa_sk", Label: "ECDSA-SK", Bits: 256, SecurityKey: true},
+	{Algorithm: ssh.KeyAlgoRSA, Name: "RSA", FileName: "id_rsa", Label: "RSA"},
+}
+
+// KeyTypeOf returns the type of key; a certificate has the type of the key
+// it certifies
+func KeyTypeOf(key ssh.PublicKey) (KeyType, error) {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	for _, t := range KeyTypes {
+		if t.Algorithm == key.Type() {
+			return t, nil
+		}
+	}
+	return KeyType{}, unsupportedKeyType(key.Type())
+}
+
+func unsupportedKeyType(algorithm string) error {
+	names := make([]string, len(KeyTypes))
+	for i, t := range KeyTypes {
+		names[i] = t.Name
+	}
+	return fmt.Errorf("unsupported key type %s; supported are %s", algorithm, strings.Join(names, ", "))
+}
+
+// keyFileNames returns the distinct default key file names in KeyTypes order
+func keyFileNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, t := range KeyTypes {
+		if !seen[t.FileName] {
+			seen[t.FileName] = true
+			names = append(names, t.FileName)
+		}
+	}
+	return names
+}
+
+// PrivateKeyType returns the type of a private key, read from its public
+// half. Passphrase-protected PEM keys only reveal the type when they are
+// decrypted; ok is false for them.
+func PrivateKeyType(privateKey string) (t KeyType, ok bool, err error) {
+	publicKey, err := ParseSSHPrivateKey(privateKey)
+	if err != nil || publicKey == nil {
+		return KeyType{}, false, err
+	}
+	t, err = KeyTypeOf(publicKey)
+	return t, err == nil, err
+}
@@ -0,0 +1,46 @@
+package git
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// GenerateSSHKey creates a new ed25519 key pair and returns the private key
+// in the OpenSSH format, encrypted if passphrase is not empty, and the public
+// key as an authorized_keys line ending in comment
+func GenerateSSHKey(comment, passphrase string) (privateKey, publicKey string, err error) {
+	if strings.ContainsAny(comment, "\r\n") {
+		return "", "", fmt.Errorf("key comment cannot contain line breaks")
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	var block *pem.Block
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, comment, []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(priv, comment)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+	publicKey = strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(sshPub)), "\n")
+	if comment != "" {
+		publicKey += " " + comment
+	}
+
+	return string(pem.EncodeToMemory(block)), publicKey + "\n", nil
+}
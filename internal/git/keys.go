@@ -0,0 +1,223 @@
+package git
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// openSSHKeyMagic starts every key in the OpenSSH private key format
+const openSSHKeyMagic = "openssh-key-v1\x00"
+
+// ParseSSHPublicKey parses a single public key in the authorized_keys
+// format, e.g. the content of id_ed25519.pub
+func ParseSSHPublicKey(content string) (ssh.PublicKey, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, fmt.Errorf("public key is empty")
+	}
+	if strings.Contains(content, "PRIVATE KEY") {
+		return nil, fmt.Errorf("this is a private key, not a public key")
+	}
+
+	key, _, _, rest, err := ssh.ParseAuthorizedKey([]byte(content))
+	if err != nil {
+		return nil, diagnosePublicKey(content)
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, fmt.Errorf("public key contains more than one key")
+	}
+
+	// the type in front of the key data is not checked by the parser
+	fields := strings.Fields(content)
+	data := base64.StdEncoding.EncodeToString(key.Marshal())
+	for i := 1; i < len(fields); i++ {
+		if fields[i] == data && fields[i-1] != key.Type() {
+			return nil, fmt.Errorf("public key is labelled %s but holds a %s key", fields[i-1], key.Type())
+		}
+	}
+
+	if _, err := KeyTypeOf(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// diagnosePublicKey explains why a public key line cannot be parsed
+func diagnosePublicKey(content string) error {
+	line, _, _ := strings.Cut(content, "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return fmt.Errorf("public key must have the form '<type> <base64 data> [comment]'")
+	}
+
+	keyType := fields[0]
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return fmt.Errorf("%s public key: the key data is not valid base64", keyType)
+	}
+	key, err := ssh.ParsePublicKey(blob)
+	if err != nil {
+		return fmt.Errorf("%s public key: %s", keyType, strings.TrimPrefix(err.Error(), "ssh: "))
+	}
+	if key.Type() != keyType {
+		return fmt.Errorf("public key is labelled %s but holds a %s key", keyType, key.Type())
+	}
+	return fmt.Errorf("%s public key: malformed key line", keyType)
+}
+
+// ParseSSHPrivateKey checks a private key in the OpenSSH, PEM or PKCS#8
+// format and returns its public key. Passphrase-protected PEM keys do not
+// reveal their public key without the passphrase; it is nil for them.
+func ParseSSHPrivateKey(content string) (ssh.PublicKey, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, fmt.Errorf("private key is empty")
+	}
+
+	block, rest := pem.Decode([]byte(content))
+	if block == nil {
+		if _, err := ParseSSHPublicKey(content); err == nil {
+			return nil, fmt.Errorf("this is a public key, not a private key")
+		}
+		return nil, fmt.Errorf("private key is not PEM encoded; expected a '-----BEGIN ... PRIVATE KEY-----' line")
+	}
+	if next, _ := pem.Decode(rest); next != nil {
+		return nil, fmt.Errorf("private key contains more than one PEM block")
+	}
+
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		return parseOpenSSHPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY", "EC PRIVATE KEY", "DSA PRIVATE KEY", "PRIVATE KEY":
+		return parsePEMPrivateKey(block, content)
+	case "ENCRYPTED PRIVATE KEY":
+		return nil, fmt.Errorf("encrypted PKCS#8 private keys are not supported; convert the key with 'ssh-keygen -p -f <file>'")
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q; expected a private key", block.Type)
+	}
+}
+
+// pemKeyFormats name the PEM private key encodings in errors
+var pemKeyFormats = map[string]string{
+	"RSA PRIVATE KEY": "PKCS#1 RSA private key",
+	"EC PRIVATE KEY":  "SEC 1 EC private key",
+	"DSA PRIVATE KEY": "DSA private key",
+	"PRIVATE KEY":     "PKCS#8 private key",
+}
+
+func parsePEMPrivateKey(block *pem.Block, content string) (ssh.PublicKey, error) {
+	format := pemKeyFormats[block.Type]
+	if block.Type == "DSA PRIVATE KEY" {
+		return nil, unsupportedKeyType(ssh.InsecureKeyAlgoDSA)
+	}
+	if strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		return nil, nil
+	}
+
+	key, err := ssh.ParseRawPrivateKey([]byte(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", format, strings.TrimPrefix(err.Error(), "ssh: "))
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported %s: %s", format, strings.TrimPrefix(err.Error(), "ssh: "))
+	}
+	if _, err := KeyTypeOf(signer.PublicKey()); err != nil {
+		return nil, err
+	}
+	return signer.PublicKey(), nil
+}
+
+// parseOpenSSHPrivateKey reads the public key stored in the unencrypted
+// header of an OpenSSH private key, which works for encrypted and security
+// key (sk-*) keys too. Unencrypted keys are parsed completely.
+func parseOpenSSHPrivateKey(data []byte) (ssh.PublicKey, error) {
+	malformed := func(problem string) error {
+		return fmt.Errorf("malformed OpenSSH private key: %s", problem)
+	}
+
+	if !bytes.HasPrefix(data, []byte(openSSHKeyMagic)) {
+		return nil, malformed("missing openssh-key-v1 header")
+	}
+	r := bytes.NewReader(data[len(openSSHKeyMagic):])
+	readString := func() ([]byte, error) {
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil || int64(n) > int64(r.Len()) {
+			return nil, errors.New("truncated")
+		}
+		s := make([]byte, n)
+		r.Read(s)
+		return s, nil
+	}
+
+	cipherName, err := readString()
+	if err != nil {
+		return nil, malformed("truncated header")
+	}
+	for i := 0; i < 2; i++ { // KDF name and options
+		if _, err := readString(); err != nil {
+			return nil, malformed("truncated header")
+		}
+	}
+	var numKeys uint32
+	if err := binary.Read(r, binary.BigEndian, &numKeys); err != nil {
+		return nil, malformed("truncated header")
+	}
+	if numKeys != 1 {
+		return nil, malformed(fmt.Sprintf("holds %d keys, expected 1", numKeys))
+	}
+	blob, err := readString()
+	if err != nil {
+		return nil, malformed("truncated public key")
+	}
+
+	publicKey, err := ssh.ParsePublicKey(blob)
+	if err != nil {
+		return nil, malformed(strings.TrimPrefix(err.Error(), "ssh: "))
+	}
+	keyType, err := KeyTypeOf(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// the private half of a security key lives on the hardware token
+	if string(cipherName) == "none" && !keyType.SecurityKey {
+		pemBytes := pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: data})
+		if _, err := ssh.ParseRawPrivateKey(pemBytes); err != nil {
+			return nil, fmt.Errorf("invalid %s private key: %s", publicKey.Type(), strings.TrimPrefix(err.Error(), "ssh: "))
+		}
+	}
+	return publicKey, nil
+}
+
+// ValidateSSHKeyPair checks that publicKey is the public half of privateKey.
+// A passphrase-protected PEM key cannot be checked and is accepted.
+func ValidateSSHKeyPair(privateKey, publicKey string) error {
+	derived, err := ParseSSHPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	public, err := ParseSSHPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	if derived == nil {
+		return nil
+	}
+
+	if cert, ok := public.(*ssh.Certificate); ok {
+		public = cert.Key
+	}
+	if !bytes.Equal(derived.Marshal(), public.Marshal()) {
+		return fmt.Errorf("the public key (%s %s) does not belong to the private key (%s %s)",
+			public.Type(), ssh.FingerprintSHA256(public), derived.Type(), ssh.FingerprintSHA256(derived))
+	}
+	return nil
+}
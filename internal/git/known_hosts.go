@@ -0,0 +1,211 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/huzaifanur/ghpm/internal/fsutil"
+	"golang.org/x/crypto/ssh"
+)
+
+// GitHubHostKeys are the host keys GitHub publishes for github.com, see
+// https://docs.github.com/en/authentication/keeping-your-account-and-data-secure/githubs-ssh-key-fingerprints
+var GitHubHostKeys = []string{
+	// SHA256:+DiY3wvvV6TuJJhbpZisF/zLDA0zPMSvHdkr4UvCOqU
+	"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl",
+	// SHA256:p2QAMXNIC1TJYWeIOttrVc98/R1BUFWu3/LiyKgUfQM
+	"ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBEmKSENjQEezOmxkZMy7opKgwFB9nkt5YRrYMjNuG5N87uRgg6CLrbo5wAdT/y6v0mKV0U2w0WZ2YB/++Tpockg=",
+	// SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s
+	"ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABgQCj7ndNxQowgcQnjshcLrqPEiiphnt+VTTvDP6mHBL9j1aNUkY4Ue1gvwnGLVlOhGeYrnZaMgRK6+PKCUXaDbC7qtbW8gIkhL7aGCsOr/C56SJMy/BCZfxd1nWzAOxSDPgVsmerOBYfNqltV9/hWCqBywINIR+5dIg6JTJ72pcEpEjcYgXkE2YEFXV1JHnsKgbLWNlhScqb2UmyRkQyytRLtL+38TGxkxCflmO+5Z8CSSNY7GidjMIZ7Q4zMjA2n1nGrlTDkzwDCsw+wqFPGQA179cnfGWOWRVruj16z6XyvxvjJwbz0wQZ75XK5tKSb7FNyeIEs4TT4jk+S4dhPeAUC5y+bDYirYgM4GC7uEnztnZyaVWQ7B381AK4Qdrwt51ZqExKbQpTUNn+EjqoTwvqNj4kqx5QUCI0ThS/YkOxJCXmPUWZbhjpCg56i+2aB6CmK2JGhn57K5mj0MNdBXA4/WnwH6XoPWJzK5Nyu2zB3nAZp+S5hpQs+p1vN1/wsjk=",
+}
+
+const knownHostsHeader = `# Host keys ghpm trusts for its SSH connection tests. The github.com keys
+# are rewritten by ghpm; lines for other hosts are keys pinned with
+# "ghpm hostkey add", e.g. for GitHub Enterprise Server.
+`
+
+// PinnedHostKey is a host key the connection test accepts for Host
+type PinnedHostKey struct {
+	Host string
+	Key  ssh.PublicKey
+	// BuiltIn is set for GitHub's own keys, which cannot be removed
+	BuiltIn bool
+}
+
+// KnownHosts is the known_hosts file ghpm runs connection tests against
+type KnownHosts struct {
+	path string
+}
+
+func NewKnownHosts(path string) *KnownHosts {
+	return &KnownHosts{path: path}
+}
+
+func (k *KnownHosts) Path() string {
+	return k.path
+}
+
+// PinnedHostKeys returns GitHub's keys followed by the keys pinned for
+// other hosts
+func (k *KnownHosts) PinnedHostKeys() ([]PinnedHostKey, error) {
+	var keys []PinnedHostKey
+	for _, line := range GitHubHostKeys {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("built-in GitHub host key: %w", err)
+		}
+		keys = append(keys, PinnedHostKey{Host: GitHubHost, Key: key, BuiltIn: true})
+	}
+
+	lines, err := k.readPinnedHostLines()
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		_, hosts, key, _, _, err := ssh.ParseKnownHosts([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k.path, err)
+		}
+		for _, host := range hosts {
+			keys = append(keys, PinnedHostKey{Host: host, Key: key})
+		}
+	}
+	return keys, nil
+}
+
+// PinHostKey trusts the keys in publicKeys for host in connection tests.
+// publicKeys holds one key per line, in the authorized_keys format or as
+// known_hosts lines such as the output of ssh-keyscan.
+func (k *KnownHosts) PinHostKey(host, publicKeys string) error {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" || strings.ContainsAny(host, " \t,*?!|") {
+		return fmt.Errorf("invalid host name %q", host)
+	}
+	if host == GitHubHost {
+		return fmt.Errorf("the keys of %s are built in", GitHubHost)
+	}
+
+	keys, err := parseHostKeys(publicKeys)
+	if err != nil {
+		return err
+	}
+	lines, err := k.readPinnedHostLines()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		entry := host + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+		if !slices.Contains(lines, entry) {
+			lines = append(lines, entry)
+		}
+	}
+	return k.write(lines)
+}
+
+func parseHostKeys(content string) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			if _, _, key, _, _, err = ssh.ParseKnownHosts([]byte(line)); err != nil {
+				return nil, fmt.Errorf("line %d is not a public host key", i+1)
+			}
+		}
+		if _, ok := key.(*ssh.Certificate); ok {
+			return nil, fmt.Errorf("host certificates cannot be pinned; pin the host key itself")
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no host key found")
+	}
+	return keys, nil
+}
+
+// UnpinHostKeys removes all keys pinned for host and returns how many there
+// were
+func (k *KnownHosts) UnpinHostKeys(host string) (int, error) {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == GitHubHost {
+		return 0, fmt.Errorf("the keys of %s are built in", GitHubHost)
+	}
+
+	lines, err := k.readPinnedHostLines()
+	if err != nil {
+		return 0, err
+	}
+	var kept []string
+	removed := 0
+	for _, line := range lines {
+		if hostField, _, _ := strings.Cut(line, " "); hostField == host {
+			removed++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, k.write(kept)
+}
+
+// Write brings GitHub's keys in the known_hosts file up to date, keeping
+// the keys pinned for other hosts
+func (k *KnownHosts) Write() error {
+	lines, err := k.readPinnedHostLines()
+	if err != nil {
+		return err
+	}
+	return k.write(lines)
+}
+
+// readPinnedHostLines returns the lines of the known_hosts file that are not
+// GitHub's built-in keys or comments
+func (k *KnownHosts) readPinnedHostLines() ([]string, error) {
+	data, err := os.ReadFile(k.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hostField, _, _ := strings.Cut(line, " "); hostField == GitHubHost {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func (k *KnownHosts) write(pinned []string) error {
+	var b strings.Builder
+	b.WriteString(knownHostsHeader)
+	for _, key := range GitHubHostKeys {
+		fmt.Fprintf(&b, "%s %s\n", GitHubHost, key)
+	}
+	for _, line := range pinned {
+		b.WriteString(line + "\n")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(k.path, []byte(b.String()), 0644); err != nil {
+		return &ConfigWriteError{Path: k.path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package git
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// maxPassphraseAttempts is how often a wrong passphrase may be entered
+// before a switch gives up
+const maxPassphraseAttempts = 3
+
+// PassphrasePrompt asks the user for the passphrase of a profile's private
+// key. attempt starts at 1 and grows after each wrong passphrase. The
+// passphrase is only ever held in memory.
+type PassphrasePrompt func(profileName string, attempt int) (string, error)
+
+// SetPassphrasePrompt sets how switches ask for the passphrase of an
+// encrypted private key. Without a prompt such keys cannot be switched to.
+func (g *Manager) SetPassphrasePrompt(prompt PassphrasePrompt) {
+	g.passphrasePrompt = prompt
+}
+
+// IsEncryptedPrivateKey reports whether a private key is protected by a
+// passphrase, in either the OpenSSH or a PEM format
+func IsEncryptedPrivateKey(privateKey string) bool {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return false
+	}
+	if strings.Contains(block.Type, "ENCRYPTED") || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		return true
+	}
+
+	_, err := ssh.ParseRawPrivateKey([]byte(privateKey))
+	var missing *ssh.PassphraseMissingError
+	return errors.As(err, &missing)
+}
+
+// parsePrivateKey parses a private key, asking for its passphrase if it is
+// encrypted
+func (g *Manager) parsePrivateKey(profileName, privateKey string) (any, error) {
+	if !IsEncryptedPrivateKey(privateKey) {
+		key, err := ssh.ParseRawPrivateKey([]byte(privateKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return key, nil
+	}
+
+	if g.passphrasePrompt == nil {
+		return nil, fmt.Errorf("the private key of profile '%s' is passphrase protected and no passphrase prompt is available", profileName)
+	}
+
+	for attempt := 1; ; attempt++ {
+		passphrase, err := g.passphrasePrompt(profileName, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := ssh.ParseRawPrivateKeyWithPassphrase([]byte(privateKey), []byte(passphrase))
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+		if attempt == maxPassphraseAttempts {
+			return nil, fmt.Errorf("incorrect passphrase for the private key of profile '%s'", profileName)
+		}
+	}
+}
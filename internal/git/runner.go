@@ -0,0 +1,84 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Timeouts of the commands a Manager runs. They bound every call on top of
+// the caller's context, so a hung git or ssh cannot block a switch forever.
+const (
+	gitCommandTimeout = 10 * time.Second
+	sshConfigTimeout  = 10 * time.Second
+	// ssh waits ConnectTimeout for the connection alone; the handshake and
+	// authentication come on top
+	sshTestTimeout = 30 * time.Second
+)
+
+// Command is an external command a Manager runs
+type Command struct {
+	Name string
+	Args []string
+	// Timeout bounds this call on top of its context; zero means no limit
+	Timeout time.Duration
+}
+
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Output is what a command printed
+type Output struct {
+	Stdout []byte
+	Stderr []byte
+}
+
+// Runner runs the git and ssh commands of a Manager. A command that ran but
+// failed returns an error with an ExitCode method, such as *exec.ExitError
+// or ExitStatus. A command stopped by its context or timeout returns the
+// context's error.
+type Runner interface {
+	Run(ctx context.Context, cmd Command) (Output, error)
+}
+
+// ExecRunner runs commands as processes
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, cmd Command) (Output, error) {
+	if cmd.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmd.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	// give up on output a killed command's children may still hold open
+	c.WaitDelay = time.Second
+
+	err := c.Run()
+	output := Output{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if err != nil && ctx.Err() != nil {
+		// killed, not failed
+		return output, ctx.Err()
+	}
+	return output, err
+}
+
+// ExitStatus is a command that ran and exited with a non-zero status, for
+// runners that do not start processes
+type ExitStatus int
+
+func (e ExitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func (e ExitStatus) ExitCode() int {
+	return int(e)
+}
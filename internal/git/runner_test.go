@@ -0,0 +1,53 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunnerTimeout(t *testing.T) {
+	fake := NewFakeRunner()
+	fake.Respond(FakeResponse{Hang: true}, "ssh")
+
+	tests := []struct {
+		name   string
+		runner Runner
+		cmd    Command
+	}{
+		{"exec", ExecRunner{}, Command{Name: "sleep", Args: []string{"10"}, Timeout: 50 * time.Millisecond}},
+		{"fake", fake, Command{Name: "ssh", Args: []string{"-T", "git@github.com"}, Timeout: 50 * time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := exec.LookPath(tt.cmd.Name); err != nil && tt.name == "exec" {
+				t.Skipf("%s is not installed", tt.cmd.Name)
+			}
+
+			start := time.Now()
+			_, err := tt.runner.Run(context.Background(), tt.cmd)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got %v, want context.DeadlineExceeded", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("the call took %v despite its %v timeout", elapsed, tt.cmd.Timeout)
+			}
+		})
+	}
+}
+
+func TestRunnerCancelled(t *testing.T) {
+	fake := NewFakeRunner()
+	fake.Respond(FakeResponse{Hang: true}, "git")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	// the call's own timeout is far off; the context ends it
+	_, err := fake.Run(ctx, Command{Name: "git", Args: []string{"fetch"}, Timeout: time.Hour})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
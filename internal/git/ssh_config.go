@@ -0,0 +1,250 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/huzaifanur/ghpm/internal/fsutil"
+)
+
+const (
+	sshConfigBlockBegin = "# >>> ghpm managed block >>> (changes inside this block are overwritten)"
+	sshConfigBlockEnd   = "# <<< ghpm managed block <<<"
+
+	// GitHubHost is the host name all generated entries connect to
+	GitHubHost = "github.com"
+)
+
+// SSHHost is a Host entry in the ghpm-managed block of ~/.ssh/config
+type SSHHost struct {
+	Host         string // pattern matched against the host given to ssh
+	HostName     string // host actually connected to
+	IdentityFile string
+	// CertificateFile is the certificate for the key, if it has one
+	CertificateFile string
+}
+
+// SSHConfigPath returns the path of the user's ssh client configuration
+func SSHConfigPath() string {
+	return filepath.Join(os.ExpandEnv("$HOME/.ssh"), "config")
+}
+
+// DefaultSSHHost returns the entry that makes the key of a profile's own
+// entry the key used for plain git@github.com URLs
+func DefaultSSHHost(own SSHHost) SSHHost {
+	own.Host = GitHubHost
+	own.HostName = GitHubHost
+	return own
+}
+
+// SSHIdentityFiles returns the identity files ssh offers when connecting to
+// host, in the order it tries them, as resolved by "ssh -G" from the
+// user's and the system's ssh configuration
+func (g *Manager) SSHIdentityFiles(ctx context.Context, host string) ([]string, error) {
+	output, err := g.runner.Run(ctx, Command{Name: "ssh", Args: []string{"-G", host}, Timeout: sshConfigTimeout})
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, &SSHError{Kind: ErrSSHNotFound, Host: host, Err: err}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve SSH configuration for %s: %w", host, err)
+	}
+
+	var files []string
+	scanner := bufio.NewScanner(strings.NewReader(string(output.Stdout)))
+	for scanner.Scan() {
+		keyword, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || keyword != "identityfile" {
+			continue
+		}
+		if strings.HasPrefix(value, "~/") {
+			value = filepath.Join(os.ExpandEnv("$HOME"), value[2:])
+		}
+		files = append(files, value)
+	}
+	return files, nil
+}
+
+// ReadManagedSSHHosts returns the entries of the ghpm-managed block in the
+// ssh config at path. A missing file or block yields no entries.
+func ReadManagedSSHHosts(path string) ([]SSHHost, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH config: %w", err)
+	}
+
+	_, block, _, found := splitManagedBlock(string(data))
+	if !found {
+		return nil, nil
+	}
+
+	var hosts []SSHHost
+	var current *SSHHost
+	scanner := bufio.NewScanner(strings.NewReader(block))
+	for scanner.Scan() {
+		keyword, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		switch strings.ToLower(keyword) {
+		case "host":
+			hosts = append(hosts, SSHHost{Host: value})
+			current = &hosts[len(hosts)-1]
+		case "hostname":
+			if current != nil {
+				current.HostName = value
+			}
+		case "identityfile":
+			if current != nil {
+				current.IdentityFile = value
+			}
+		case "certificatefile":
+			if current != nil {
+				current.CertificateFile = value
+			}
+		}
+	}
+
+	return hosts, nil
+}
+
+// WriteManagedSSHHosts replaces the ghpm-managed block in the ssh config at
+// path with hosts. Everything outside the block is preserved byte for byte.
+// The block is kept before the first Host or Match section of the user, see
+// insertManagedBlock. An empty hosts list removes the block.
+func WriteManagedSSHHosts(path string, hosts []SSHHost) error {
+	// write through symlinks, e.g. dotfile managers linking ~/.ssh/config
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	perm := os.FileMode(0600)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read SSH config: %w", err)
+	}
+	if info, statErr := os.Stat(path); statErr == nil {
+		perm = info.Mode().Perm()
+	}
+
+	var block strings.Builder
+	if len(hosts) > 0 {
+		block.WriteString(sshConfigBlockBegin + "\n")
+		for _, h := range hosts {
+			fmt.Fprintf(&block, "Host %s\n", h.Host)
+			fmt.Fprintf(&block, "    HostName %s\n", h.HostName)
+			fmt.Fprintf(&block, "    User git\n")
+			fmt.Fprintf(&block, "    IdentityFile %s\n", quoteSSHConfigValue(h.IdentityFile))
+			if h.CertificateFile != "" {
+				fmt.Fprintf(&block, "    CertificateFile %s\n", quoteSSHConfigValue(h.CertificateFile))
+			}
+			fmt.Fprintf(&block, "    IdentitiesOnly yes\n")
+		}
+		block.WriteString(sshConfigBlockEnd + "\n")
+	}
+
+	var content string
+	before, _, after, found := splitManagedBlock(string(data))
+	switch {
+	case !found && len(hosts) == 0:
+		content = string(data)
+	case found && (len(hosts) == 0 || sectionStart(before) < 0):
+		content = before + block.String() + after
+	case found:
+		// written behind the user's sections by an earlier version
+		if after == "" && strings.HasSuffix(before, "\n\n") {
+			before = before[:len(before)-1]
+		}
+		content = insertManagedBlock(before+after, block.String())
+	default:
+		content = insertManagedBlock(string(data), block.String())
+	}
+	if content == string(data) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create SSH directory: %w", err)
+	}
+
+	if err := fsutil.WriteFileAtomic(path, []byte(content), perm); err != nil {
+		return &ConfigWriteError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// insertManagedBlock puts block before the first Host or Match section in
+// content, or at the end if there is none. ssh takes the first value it finds
+// for most options and offers identity files in the order they appear, so
+// behind a user's "Host *" with its own IdentityFile the managed entries
+// would lose. Options above the first section apply to every host wherever
+// the block is.
+func insertManagedBlock(content, block string) string {
+	start := sectionStart(content)
+	if start < 0 {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if content != "" {
+			content += "\n"
+		}
+		return content + block
+	}
+	return content[:start] + block + "\n" + content[start:]
+}
+
+// sectionStart returns the offset of the first line of content starting a
+// Host or Match section, or -1
+func sectionStart(content string) int {
+	offset := 0
+	for _, line := range strings.SplitAfter(content, "\n") {
+		keyword := strings.TrimSpace(line)
+		if i := strings.IndexAny(keyword, " \t="); i >= 0 {
+			keyword = keyword[:i]
+		}
+		if strings.EqualFold(keyword, "Host") || strings.EqualFold(keyword, "Match") {
+			return offset
+		}
+		offset += len(line)
+	}
+	return -1
+}
+
+// splitManagedBlock splits content into the text before the managed block,
+// the lines inside it and the text after it
+func splitManagedBlock(content string) (before, block, after string, found bool) {
+	start := strings.Index(content, sshConfigBlockBegin)
+	if start < 0 || (start > 0 && content[start-1] != '\n') {
+		return content, "", "", false
+	}
+
+	rest := content[start:]
+	end := strings.Index(rest, sshConfigBlockEnd)
+	if end < 0 {
+		return content, "", "", false
+	}
+
+	blockEnd := start + end + len(sshConfigBlockEnd)
+	if blockEnd < len(content) && content[blockEnd] == '\n' {
+		blockEnd++
+	}
+
+	return content[:start], rest[len(sshConfigBlockBegin):end], content[blockEnd:], true
+}
+
+func quoteSSHConfigValue(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
@@ -0,0 +1,94 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteManagedSSHHostsPlacement(t *testing.T) {
+	hosts := []SSHHost{{Host: "github.com", HostName: "github.com", IdentityFile: "/home/u/.ssh/ghpm_work"}}
+	block := sshConfigBlockBegin + "\n" +
+		"Host github.com\n" +
+		"    HostName github.com\n" +
+		"    User git\n" +
+		"    IdentityFile /home/u/.ssh/ghpm_work\n" +
+		"    IdentitiesOnly yes\n" +
+		sshConfigBlockEnd + "\n"
+
+	tests := []struct {
+		name  string
+		input string
+		hosts []SSHHost
+		want  string
+	}{
+		{
+			name:  "new file",
+			hosts: hosts,
+			want:  block,
+		},
+		{
+			name:  "appended without sections",
+			input: "ServerAliveInterval 30",
+			hosts: hosts,
+			want:  "ServerAliveInterval 30\n\n" + block,
+		},
+		{
+			name:  "inserted before the first section",
+			input: "ServerAliveInterval 30\n\nHost *\n    IdentityFile ~/.ssh/id_rsa\n",
+			hosts: hosts,
+			want:  "ServerAliveInterval 30\n\n" + block + "\nHost *\n    IdentityFile ~/.ssh/id_rsa\n",
+		},
+		{
+			name:  "inserted before Match",
+			input: "match all\n    IdentityFile ~/.ssh/id_rsa\n",
+			hosts: hosts,
+			want:  block + "\nmatch all\n    IdentityFile ~/.ssh/id_rsa\n",
+		},
+		{
+			name:  "moved in front of the user's sections",
+			input: "Host=*\n    IdentityFile ~/.ssh/id_rsa\n\n" + sshConfigBlockBegin + "\nHost old\n" + sshConfigBlockEnd + "\n",
+			hosts: hosts,
+			want:  block + "\nHost=*\n    IdentityFile ~/.ssh/id_rsa\n",
+		},
+		{
+			name:  "replaced in place",
+			input: "# mine\n" + sshConfigBlockBegin + "\nHost old\n" + sshConfigBlockEnd + "\nHost *\n    User me\n",
+			hosts: hosts,
+			want:  "# mine\n" + block + "Host *\n    User me\n",
+		},
+		{
+			name:  "removed",
+			input: "# mine\n" + block + "Host *\n    User me\n",
+			want:  "# mine\nHost *\n    User me\n",
+		},
+		{
+			name:  "nothing to remove",
+			input: "Host *\n    User me",
+			want:  "Host *\n    User me",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config")
+			if tt.input != "" {
+				if err := os.WriteFile(path, []byte(tt.input), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := WriteManagedSSHHosts(path, tt.hosts); err != nil {
+				t.Fatalf("WriteManagedSSHHosts: %v", err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/huzaifanur/ghpm/internal/fsutil"
+	"golang.org/x/crypto/ssh"
+)
+
+// gitValue is the state of a global git config key before a switch
+type gitValue struct {
+	key   string
+	value string
+	set   bool
+}
+
+// fileState is the state of a file before a switch
+type fileState struct {
+	path    string
+	data    []byte
+	mode    os.FileMode
+	existed bool
+}
+
+// switchTransaction records everything a profile switch may change so the
+// switch can be undone if a later step fails
+type switchTransaction struct {
+	gitValues []gitValue
+	files     []fileState
+
+	// key added to ssh-agent by the agent strategy
+	agentKey           ssh.PublicKey
+	agentKeyWasPresent bool
+}
+
+func (g *Manager) beginSwitch(profile ProfileInterface) (*switchTransaction, error) {
+	tx := &switchTransaction{}
+
+	cfg, err := readGlobalGitConfig()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"user.name", "user.email"} {
+		value, set := cfg.Get(key)
+		tx.gitValues = append(tx.gitValues, gitValue{key: key, value: value, set: set})
+	}
+
+	if profile.HasSSHKeys() {
+		for _, path := range profile.SSHFilePaths() {
+			state, err := captureFile(path)
+			if err != nil {
+				return nil, err
+			}
+			tx.files = append(tx.files, state)
+		}
+	}
+
+	return tx, nil
+}
+
+// rollback restores the recorded state, returning what was restored and
+// what could not be
+func (tx *switchTransaction) rollback(g *Manager) (restored []string, errs []error) {
+	if err := tx.restoreGitValues(); err != nil {
+		errs = append(errs, err)
+	} else {
+		for _, v := range tx.gitValues {
+			restored = append(restored, "git "+v.key)
+		}
+	}
+
+	if tx.agentKey != nil && !tx.agentKeyWasPresent {
+		if err := g.RemoveAgentKey(tx.agentKey); err != nil {
+			errs = append(errs, err)
+		} else {
+			restored = append(restored, "ssh-agent key")
+		}
+	}
+
+	for _, f := range tx.files {
+		if err := f.restore(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", f.path, err))
+			continue
+		}
+		restored = append(restored, f.path)
+	}
+
+	return restored, errs
+}
+
+func captureFile(path string) (fileState, error) {
+	// record the file a write would actually replace
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	state := fileState{path: path}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	state.data = data
+	state.mode = info.Mode().Perm()
+	state.existed = true
+	return state, nil
+}
+
+func (f fileState) restore() error {
+	if !f.existed {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if current, err := os.ReadFile(f.path); err == nil && string(current) == string(f.data) {
+		return os.Chmod(f.path, f.mode)
+	}
+
+	return fsutil.WriteFileAtomic(f.path, f.data, f.mode)
+}
+
+// restoreGitValues puts the recorded git config values back in one write
+func (tx *switchTransaction) restoreGitValues() error {
+	cfg, err := readGlobalGitConfig()
+	if err != nil {
+		return fmt.Errorf("failed to restore git config: %w", err)
+	}
+	before := string(cfg.Bytes())
+	for _, v := range tx.gitValues {
+		if !v.set {
+			cfg.Unset(v.key)
+			continue
+		}
+		if err := cfg.Set(v.key, v.value); err != nil {
+			return fmt.Errorf("failed to restore git %s: %w", v.key, err)
+		}
+	}
+	// a switch that failed before writing the identity left nothing to undo
+	if string(cfg.Bytes()) == before {
+		return nil
+	}
+	if err := cfg.Write(); err != nil {
+		return fmt.Errorf("failed to restore git config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package keyfiles
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/huzaifanur/ghpm/internal/backup"
+	"github.com/huzaifanur/ghpm/internal/fsutil"
+)
+
+// Manifest records the files ghpm wrote and a hash of what it wrote, so
+// files it no longer needs can be removed without ever touching a file the
+// user created or changed
+type Manifest struct {
+	path string
+	// backups receives the files Retire removes
+	backups *backup.Store
+}
+
+// Entry is one file written by ghpm
+type Entry struct {
+	Path    string `json:"path"`
+	Profile string `json:"profile"`
+	SHA256  string `json:"sha256"`
+}
+
+func NewManifest(path string, backups *backup.Store) *Manifest {
+	return &Manifest{path: path, backups: backups}
+}
+
+// Record notes that files (path to content) were written for profile
+func (m *Manifest) Record(profile string, files map[string][]byte) error {
+	entries, err := m.Entries()
+	if err != nil {
+		return err
+	}
+
+	byPath := make(map[string]Entry, len(entries)+len(files))
+	for _, e := range entries {
+		byPath[e.Path] = e
+	}
+	for path, data := range files {
+		byPath[path] = Entry{Path: path, Profile: profile, SHA256: hash(data)}
+	}
+
+	return m.save(byPath)
+}
+
+// Entries returns the recorded files sorted by path
+func (m *Manifest) Entries() ([]Entry, error) {
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file manifest: %w", err)
+	}
+
+	var entries []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil || e.Path == "" {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Retire removes every recorded file not in keep that still holds exactly
+// what ghpm wrote, after copying it into a backup snapshot. Files that were
+// changed or deleted since are only forgotten. It returns the removed paths.
+func (m *Manifest) Retire(keep map[string]bool, reason string) ([]string, error) {
+	entries, err := m.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := make(map[string]Entry, len(entries))
+	var stale []Entry
+	var stalePaths []string
+	for _, e := range entries {
+		if keep[e.Path] {
+			remaining[e.Path] = e
+			continue
+		}
+		if data, err := os.ReadFile(e.Path); err == nil && hash(data) == e.SHA256 {
+			stale = append(stale, e)
+			stalePaths = append(stalePaths, e.Path)
+		}
+	}
+
+	if len(stale) > 0 {
+		if _, err := m.backups.Snapshot(reason, stalePaths...); err != nil {
+			return nil, fmt.Errorf("failed to back up stale key files: %w", err)
+		}
+	}
+
+	var removed []string
+	for _, e := range stale {
+		if err := os.Remove(e.Path); err != nil && !os.IsNotExist(err) {
+			// keep tracking it so the next run tries again
+			remaining[e.Path] = e
+			continue
+		}
+		removed = append(removed, e.Path)
+	}
+
+	if len(remaining) == len(entries) {
+		return removed, nil
+	}
+	return removed, m.save(remaining)
+}
+
+func (m *Manifest) save(byPath map[string]Entry) error {
+	paths := make([]string, 0, len(byPath))
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, path := range paths {
+		if err := enc.Encode(byPath[path]); err != nil {
+			return fmt.Errorf("failed to marshal key file manifest: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(m.path, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write key file manifest: %w", err)
+	}
+	return nil
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -1,14 +1,24 @@
 package profile
 
 import (
+    "context"
     "fmt"
     "os"
     "path/filepath"
+    "regexp"
     "strings"
 
+    "github.com/huzaifanur/ghpm/internal/backup"
+    "github.com/huzaifanur/ghpm/internal/fsutil"
     "github.com/huzaifanur/ghpm/internal/git"
+    "github.com/huzaifanur/ghpm/internal/keyfiles"
+    "github.com/huzaifanur/ghpm/internal/secrets"
 )
 
+// unsafeKeyNameChars matches characters not allowed in key file names and
+// ssh host aliases
+var unsafeKeyNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
 type Profile struct {
 	Name          string `json:"name"`
 	GitUsername   string `json:"git_username"`
@@ -17,6 +27,57 @@ type Profile struct {
 	SSHPublicKey  string `json:"ssh_public_key"`
 	IsActive      bool   `json:"is_active"`
 	CreatedFrom   string `json:"created_from"`
+
+	// SSHPrivateKeyRef points to the private key in a secret backend; the
+	// profile file then holds no private key and SSHPrivateKey is only
+	// filled in by ResolvePrivateKey
+	SSHPrivateKeyRef string `json:"ssh_private_key_ref,omitempty"`
+	// SSHKeyEncrypted records whether the private key is passphrase
+	// protected when it was stored, so that this is known without loading
+	// a key kept in a secret backend
+	SSHKeyEncrypted bool `json:"ssh_key_encrypted,omitempty"`
+	// IdentityFile is an existing private key the profile uses in place,
+	// with its public key next to it. Such a profile holds no key material,
+	// so a key rotated on disk is picked up by the next switch.
+	IdentityFile string `json:"identity_file,omitempty"`
+	// SSHCertificate is an optional certificate for the key, e.g. one
+	// signed by a GitHub Enterprise SSH CA. A profile using key files in
+	// place uses the certificate next to them instead.
+	SSHCertificate string `json:"ssh_certificate,omitempty"`
+	// GitHubLogin is the GitHub account the key belongs to; when set, the
+	// SSH connection test checks that GitHub authenticates the key as it
+	GitHubLogin string `json:"github_login,omitempty"`
+
+	// Directories binds the profile to repositories below these paths
+	Directories []string `json:"directories,omitempty"`
+	// RemoteURLs binds the profile to repositories with a matching remote
+	RemoteURLs []string `json:"remote_urls,omitempty"`
+
+	storage *Storage
+}
+
+// Storage is where the files ghpm keeps besides the profile file live, all
+// inside the config directory. Config sets it on the profiles it holds.
+type Storage struct {
+	// Backups receives key files before they are overwritten
+	Backups *backup.Store
+	// KeyFiles records the key files written to ~/.ssh
+	KeyFiles *keyfiles.Manifest
+	// SecretsDir is where the file secret backend keeps private keys
+	SecretsDir string
+}
+
+// SetStorage places the files of the profile in storage
+func (p *Profile) SetStorage(storage *Storage) {
+	p.storage = storage
+}
+
+// Storage returns where the files of the profile live
+func (p *Profile) Storage() (*Storage, error) {
+	if p.storage == nil {
+		return nil, fmt.Errorf("profile '%s' does not belong to a config directory", p.Name)
+	}
+	return p.storage, nil
 }
 
 func (p *Profile) Validate() error {
@@ -37,37 +98,280 @@ func (p *Profile) Validate() error {
     if err := git.ValidateGitInput(p.GitUsername, p.GitEmail); err != nil {
         return fmt.Errorf("invalid git configuration: %w", err)
     }
+    if p.GitHubLogin != "" {
+        if err := git.ValidateGitHubLogin(p.GitHubLogin); err != nil {
+            return err
+        }
+    }
 
     // SSH keys are mandatory for a valid profile
-    if p.SSHPrivateKey == "" || p.SSHPublicKey == "" {
+    if p.IdentityFile != "" {
+        if err := git.ValidateIdentityFile(p.IdentityFile); err != nil {
+            return fmt.Errorf("invalid key file: %w", err)
+        }
+    } else if !p.HasSSHKeys() {
         return fmt.Errorf("SSH private and public keys are required")
+    } else if p.SSHPrivateKey != "" {
+        // a key kept in a secret backend was checked when it was stored
+        if err := git.ValidateSSHKeyPair(p.SSHPrivateKey, p.SSHPublicKey); err != nil {
+            return fmt.Errorf("invalid SSH keys: %w", err)
+        }
+    }
+    if p.SSHCertificate != "" {
+        if p.IdentityFile != "" {
+            return fmt.Errorf("a profile using key files in place takes its certificate from %s-cert.pub", p.IdentityFile)
+        }
+        if err := git.ValidateSSHCertificate(p.SSHCertificate, p.SSHPublicKey); err != nil {
+            return fmt.Errorf("invalid SSH certificate: %w", err)
+        }
     }
 
+	for _, dir := range p.Directories {
+		if err := git.ValidateIncludeDirectory(dir); err != nil {
+			return fmt.Errorf("invalid directory binding: %w", err)
+		}
+	}
+	for _, pattern := range p.RemoteURLs {
+		if err := git.ValidateRemoteURLPattern(pattern); err != nil {
+			return fmt.Errorf("invalid remote URL binding: %w", err)
+		}
+	}
+
     return nil
 }
 
+// HasBindings reports whether the profile is bound to directories or remotes
+func (p *Profile) HasBindings() bool {
+	return len(p.Directories) > 0 || len(p.RemoteURLs) > 0
+}
+
 func (p *Profile) HasSSHKeys() bool {
-	return p.SSHPrivateKey != "" && p.SSHPublicKey != ""
+	if p.IdentityFile != "" {
+		return true
+	}
+	return (p.SSHPrivateKey != "" || p.SSHPrivateKeyRef != "") && p.SSHPublicKey != ""
 }
 
-func (p *Profile) detectKeyType() string {
+// IsReference reports whether the profile uses existing key files in place
+// instead of holding the keys
+func (p *Profile) IsReference() bool {
+	return p.IdentityFile != ""
+}
+
+// HasEncryptedKey reports whether the private key is passphrase protected.
+// A key kept in a secret backend is not loaded just to answer this; the
+// flag recorded when it was stored answers instead.
+func (p *Profile) HasEncryptedKey() bool {
+	if p.IdentityFile != "" {
+		data, err := os.ReadFile(p.IdentityFile)
+		return err == nil && git.IsEncryptedPrivateKey(string(data))
+	}
 	if p.SSHPublicKey == "" {
-		return "id_rsa"
+		return false
+	}
+	if p.SSHPrivateKey != "" {
+		return git.IsEncryptedPrivateKey(p.SSHPrivateKey)
+	}
+	return p.SSHPrivateKeyRef != "" && p.SSHKeyEncrypted
+}
+
+// UseKeyFile makes the profile use an existing private key file in place,
+// dropping any key material and certificate it held
+func (p *Profile) UseKeyFile(path string) error {
+	if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(os.ExpandEnv("$HOME"), path[2:])
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("invalid key file path: %w", err)
+	}
+	if err := git.ValidateIdentityFile(path); err != nil {
+		return err
+	}
+
+	p.IdentityFile = path
+	p.SSHPrivateKey = ""
+	p.SSHPublicKey = ""
+	p.SSHPrivateKeyRef = ""
+	p.SSHKeyEncrypted = false
+	p.SSHCertificate = ""
+	return nil
+}
+
+// ResolvePrivateKey loads the private key from its secret backend if the
+// profile only holds a reference to it
+func (p *Profile) ResolvePrivateKey() error {
+	if p.SSHPrivateKey != "" || p.SSHPrivateKeyRef == "" {
+		return nil
+	}
+
+	storage, err := p.Storage()
+	if err != nil {
+		return err
+	}
+	privateKey, err := secrets.Lookup(p.SSHPrivateKeyRef, storage.SecretsDir)
+	if err != nil {
+		return fmt.Errorf("failed to load the private key of profile '%s': %w", p.Name, err)
+	}
+	p.SSHPrivateKey = privateKey
+	// profiles stored before the flag existed learn it here
+	p.SSHKeyEncrypted = git.IsEncryptedPrivateKey(privateKey)
+	return nil
+}
+
+// SSHKeyName returns the file name of the profile's private key in ~/.ssh
+func (p *Profile) SSHKeyName() string {
+	return "ghpm_" + unsafeKeyNameChars.ReplaceAllString(p.Name, "_")
+}
+
+// SSHKeyPath returns where the profile's private key is stored in ~/.ssh;
+// the public key sits next to it with a .pub suffix
+func (p *Profile) SSHKeyPath() string {
+	return filepath.Join(os.ExpandEnv("$HOME/.ssh"), p.SSHKeyName())
+}
+
+// SSHIdentityFile returns the file ssh is pointed at for this profile: the
+// private key, or with the agent strategy the public key, whose private half
+// ssh then takes from ssh-agent
+func (p *Profile) SSHIdentityFile(strategy git.SSHKeyStrategy) string {
+	keyPath := p.SSHKeyPath()
+	if p.IdentityFile != "" {
+		keyPath = p.IdentityFile
+	}
+	if p.KeyStrategy(strategy) == git.SSHKeyStrategyAgent {
+		return keyPath + ".pub"
+	}
+	return keyPath
+}
+
+// SSHCertificatePath returns where ssh finds the profile's certificate, or
+// an empty string if it has none
+func (p *Profile) SSHCertificatePath() string {
+	if p.IdentityFile != "" {
+		path := p.IdentityFile + "-cert.pub"
+		if _, err := os.Stat(path); err != nil {
+			return ""
+		}
+		return path
+	}
+	if p.SSHCertificate == "" {
+		return ""
+	}
+	return p.SSHKeyPath() + "-cert.pub"
+}
+
+// GetSSHCertificate returns the profile's certificate, or an empty string
+// if it has none
+func (p *Profile) GetSSHCertificate() (string, error) {
+	if p.IdentityFile == "" {
+		return p.SSHCertificate, nil
+	}
+	path := p.SSHCertificatePath()
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read certificate: %w", err)
+	}
+	return string(data), nil
+}
+
+// Certificate returns what the profile's certificate says; nil if the
+// profile has none
+func (p *Profile) Certificate() (*git.CertificateInfo, error) {
+	content, err := p.GetSSHCertificate()
+	if err != nil || content == "" {
+		return nil, err
+	}
+	cert, err := git.ParseSSHCertificate(content)
+	if err != nil {
+		return nil, err
+	}
+	info := git.NewCertificateInfo(cert)
+	return &info, nil
+}
+
+// KeyType returns the type of the profile's key, read from its public key
+func (p *Profile) KeyType() (git.KeyType, error) {
+	publicKey, err := p.GetSSHPublicKey()
+	if err != nil {
+		return git.KeyType{}, err
+	}
+	key, err := git.ParseSSHPublicKey(publicKey)
+	if err != nil {
+		return git.KeyType{}, err
+	}
+	return git.KeyTypeOf(key)
+}
+
+// Fingerprint returns the fingerprints of the profile's stored public key;
+// nil if the profile has no keys
+func (p *Profile) Fingerprint() (*git.KeyFingerprint, error) {
+	if !p.HasSSHKeys() {
+		return nil, nil
+	}
+	publicKey, err := p.GetSSHPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return git.FingerprintSSHPublicKey(publicKey)
+}
+
+// VerifyActiveKey checks by fingerprint that the key ssh uses for github.com
+// is the profile's key
+func (p *Profile) VerifyActiveKey(ctx context.Context, g *git.Manager) error {
+	stored, err := p.Fingerprint()
+	if err != nil || stored == nil {
+		return err
+	}
+	onDisk, err := g.GetSSHKeyFingerprint(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot compare with the key ssh uses: %w", err)
+	}
+	if !stored.Matches(onDisk) {
+		return fmt.Errorf("ssh uses the key %s for github.com, not this profile's key %s", onDisk.SHA256, stored.SHA256)
+	}
+	return nil
+}
+
+// KeyStrategy returns how the profile's key is handed to ssh under strategy.
+// Security keys cannot be loaded into ssh-agent by ghpm, so they are always
+// written to files.
+func (p *Profile) KeyStrategy(strategy git.SSHKeyStrategy) git.SSHKeyStrategy {
+	if t, err := p.KeyType(); err == nil && t.SecurityKey {
+		return git.SSHKeyStrategyFiles
 	}
+	return strategy
+}
 
-	publicKey := strings.TrimSpace(p.SSHPublicKey)
+// SSHHost returns the ~/.ssh/config entry that selects this profile's key
+// through the github.com-<profile> host alias
+func (p *Profile) SSHHost(strategy git.SSHKeyStrategy) git.SSHHost {
+	return git.SSHHost{
+		Host:            git.GitHubHost + "-" + strings.TrimPrefix(p.SSHKeyName(), "ghpm_"),
+		HostName:        git.GitHubHost,
+		IdentityFile:    p.SSHIdentityFile(strategy),
+		CertificateFile: p.SSHCertificatePath(),
+	}
+}
 
-	if strings.HasPrefix(publicKey, "ssh-ed25519") {
-		return "id_ed25519"
-	} else if strings.HasPrefix(publicKey, "ssh-ecdsa") {
-		return "id_ecdsa"
-	} else if strings.HasPrefix(publicKey, "ssh-rsa") {
-		return "id_rsa"
-	} else if strings.HasPrefix(publicKey, "ssh-dss") {
-		return "id_dsa"
+// GenerateSSHKeys gives the profile a new ed25519 key pair commented with its
+// email, replacing any key it held. The private key is encrypted with
+// passphrase unless it is empty.
+func (p *Profile) GenerateSSHKeys(passphrase string) error {
+	privateKey, publicKey, err := git.GenerateSSHKey(p.GitEmail, passphrase)
+	if err != nil {
+		return err
 	}
 
-	return "id_rsa"
+	p.SSHPrivateKey = privateKey
+	p.SSHPublicKey = publicKey
+	p.SSHPrivateKeyRef = ""
+	p.IdentityFile = ""
+	// a certificate only certifies the key it was issued for
+	p.SSHCertificate = ""
+	return nil
 }
 
 func (p *Profile) LoadSSHKeysFromFiles(privateKeyPath, publicKeyPath string) error {
@@ -90,11 +394,67 @@ func (p *Profile) LoadSSHKeysFromFiles(privateKeyPath, publicKeyPath string) err
 	return nil
 }
 
-func (p *Profile) WriteSSHKeysToSystem() error {
+// WriteSSHKeysToSystem writes the profile's key files under its own name in
+// ~/.ssh and makes them the key used for github.com in the ghpm-managed
+// block of ~/.ssh/config. Keys of other profiles and anything outside the
+// block are left untouched.
+func (p *Profile) WriteSSHKeysToSystem(strategy git.SSHKeyStrategy) error {
 	if !p.HasSSHKeys() {
 		return nil
 	}
 
+	if err := p.WriteSSHKeyFiles(strategy); err != nil {
+		return err
+	}
+
+	configPath := git.SSHConfigPath()
+	hosts, err := git.ReadManagedSSHHosts(configPath)
+	if err != nil {
+		return err
+	}
+
+	own := p.SSHHost(strategy)
+	updated := []git.SSHHost{git.DefaultSSHHost(own)}
+	for _, h := range hosts {
+		if h.Host != git.GitHubHost && h.Host != own.Host {
+			updated = append(updated, h)
+		}
+	}
+	updated = append(updated, own)
+
+	if err := git.WriteManagedSSHHosts(configPath, updated); err != nil {
+		return fmt.Errorf("failed to update SSH config: %w", err)
+	}
+
+	return nil
+}
+
+// SSHFilePaths lists every file WriteSSHKeysToSystem may change
+func (p *Profile) SSHFilePaths() []string {
+	if p.IdentityFile != "" {
+		return []string{git.SSHConfigPath()}
+	}
+	return []string{p.SSHKeyPath(), p.SSHKeyPath() + ".pub", p.SSHKeyPath() + "-cert.pub", git.SSHConfigPath()}
+}
+
+// WriteSSHKeyFiles writes the profile's key pair to SSHKeyPath. With the
+// agent strategy only the public key is written; the private key never
+// touches the disk. A profile using key files in place only has them
+// checked again.
+func (p *Profile) WriteSSHKeyFiles(strategy git.SSHKeyStrategy) error {
+	if p.IdentityFile != "" {
+		if err := git.ValidateIdentityFile(p.IdentityFile); err != nil {
+			return fmt.Errorf("key file of profile '%s': %w", p.Name, err)
+		}
+		return nil
+	}
+
+	storage, err := p.Storage()
+	if err != nil {
+		return err
+	}
+
+	strategy = p.KeyStrategy(strategy)
 	sshDir := os.ExpandEnv("$HOME/.ssh")
 
 	if err := os.MkdirAll(sshDir, 0700); err != nil {
@@ -109,57 +469,115 @@ func (p *Profile) WriteSSHKeysToSystem() error {
 		}
 	}
 
-	keyType := p.detectKeyType()
+	privateKeyPath := p.SSHKeyPath()
+	publicKeyPath := privateKeyPath + ".pub"
 
-	privateKeyPath := filepath.Join(sshDir, keyType)
-	if err := p.atomicWriteFile(privateKeyPath, []byte(p.SSHPrivateKey), 0600); err != nil {
-		return fmt.Errorf("failed to write private key: %w", err)
+	contents := map[string][]byte{
+		publicKeyPath: []byte(p.SSHPublicKey),
+	}
+	if p.SSHCertificate != "" {
+		contents[p.SSHCertificatePath()] = []byte(withTrailingNewline(p.SSHCertificate))
+	}
+	if strategy != git.SSHKeyStrategyAgent {
+		if err := p.ResolvePrivateKey(); err != nil {
+			return err
+		}
+		contents[privateKeyPath] = []byte(withTrailingNewline(p.SSHPrivateKey))
+	}
+
+	// keys changed on disk since ghpm wrote them are kept in a backup
+	if _, err := storage.Backups.SnapshotChanged(
+		fmt.Sprintf("before writing keys of profile '%s'", p.Name), contents,
+	); err != nil {
+		return fmt.Errorf("failed to back up existing SSH keys: %w", err)
+	}
+
+	if strategy != git.SSHKeyStrategyAgent {
+		if err := p.WritePrivateKeyFile(privateKeyPath); err != nil {
+			return err
+		}
 	}
 
-	publicKeyPath := filepath.Join(sshDir, keyType+".pub")
-	if err := p.atomicWriteFile(publicKeyPath, []byte(p.SSHPublicKey), 0644); err != nil {
+	if err := fsutil.WriteFileAtomic(publicKeyPath, []byte(p.SSHPublicKey), 0644); err != nil {
 		return fmt.Errorf("failed to write public key: %w", err)
 	}
+	if p.SSHCertificate != "" {
+		if err := fsutil.WriteFileAtomic(p.SSHCertificatePath(), []byte(withTrailingNewline(p.SSHCertificate)), 0644); err != nil {
+			return fmt.Errorf("failed to write certificate: %w", err)
+		}
+	}
+
+	// remembered so the files can be retired once no profile needs them
+	if err := storage.KeyFiles.Record(p.Name, contents); err != nil {
+		return err
+	}
 
 	return nil
 }
 
-func (p *Profile) atomicWriteFile(filename string, data []byte, perm os.FileMode) error {
-	dir := filepath.Dir(filename)
-	tmpFile, err := os.CreateTemp(dir, filepath.Base(filename)+".tmp")
-	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %w", err)
+// WriteSSHKeysToTempDir writes the private key into a new private temporary
+// directory. The returned cleanup function removes the directory again. A
+// profile using a key file in place returns that file instead.
+func (p *Profile) WriteSSHKeysToTempDir() (string, func(), error) {
+	if !p.HasSSHKeys() {
+		return "", nil, fmt.Errorf("profile '%s' has no SSH keys", p.Name)
 	}
-
-	tmpPath := tmpFile.Name()
-	defer func() {
-		tmpFile.Close()
-		os.Remove(tmpPath)
-	}()
-
-	if _, err := tmpFile.Write(data); err != nil {
-		return fmt.Errorf("failed to write to temporary file: %w", err)
+	if p.IdentityFile != "" {
+		if err := git.ValidateIdentityFile(p.IdentityFile); err != nil {
+			return "", nil, err
+		}
+		return p.IdentityFile, func() {}, nil
 	}
 
-	if err := tmpFile.Chmod(perm); err != nil {
-		return fmt.Errorf("failed to set permissions on temporary file: %w", err)
+	dir, err := os.MkdirTemp("", "ghpm-exec-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary key directory: %w", err)
 	}
-
-	if err := tmpFile.Sync(); err != nil {
-		return fmt.Errorf("failed to sync temporary file: %w", err)
+	cleanup := func() {
+		os.RemoveAll(dir)
 	}
 
-	if err := tmpFile.Close(); err != nil {
-		return fmt.Errorf("failed to close temporary file: %w", err)
+	privateKeyPath := filepath.Join(dir, "id_key")
+	if err := p.WritePrivateKeyFile(privateKeyPath); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	// ssh loads the certificate next to the key given with -i
+	if p.SSHCertificate != "" {
+		if err := fsutil.WriteFileAtomic(privateKeyPath+"-cert.pub", []byte(withTrailingNewline(p.SSHCertificate)), 0644); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to write certificate: %w", err)
+		}
 	}
 
-	if err := os.Rename(tmpPath, filename); err != nil {
-		return fmt.Errorf("failed to rename temporary file: %w", err)
+	return privateKeyPath, cleanup, nil
+}
+
+// WritePrivateKeyFile atomically writes the private key to path with 0600
+// permissions, creating the parent directory with 0700 if needed
+func (p *Profile) WritePrivateKeyFile(path string) error {
+	if err := p.ResolvePrivateKey(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
 	}
 
+	if err := fsutil.WriteFileAtomic(path, []byte(withTrailingNewline(p.SSHPrivateKey)), 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
 	return nil
 }
 
+// withTrailingNewline terminates key material with a newline; ssh rejects
+// private keys without one
+func withTrailingNewline(key string) string {
+	if strings.HasSuffix(key, "\n") {
+		return key
+	}
+	return key + "\n"
+}
+
 func (p *Profile) String() string {
 	active := ""
 	if p.IsActive {
@@ -169,7 +587,10 @@ func (p *Profile) String() string {
 	return fmt.Sprintf("%s <%s>%s", p.GitUsername, p.GitEmail, active)
 }
 
-func CreateFromSystem(name string) (*Profile, error) {
+// CreateFromSystem builds a profile from the current git identity and the
+// default SSH key. With inPlace the profile uses the detected key files
+// instead of copying them.
+func CreateFromSystem(name string, inPlace bool) (*Profile, error) {
 	profile := &Profile{
 		Name:        name,
 		CreatedFrom: "system",
@@ -189,6 +610,12 @@ func CreateFromSystem(name string) (*Profile, error) {
     if err != nil {
         return nil, fmt.Errorf("failed to detect SSH keys: %w", err)
     }
+    if inPlace {
+        if err := profile.UseKeyFile(privateKeyPath); err != nil {
+            return nil, err
+        }
+        return profile, nil
+    }
     if data, err := os.ReadFile(privateKeyPath); err == nil {
         profile.SSHPrivateKey = string(data)
     }
@@ -208,6 +635,13 @@ func (p *Profile) Clone(newName string) *Profile {
 		SSHPublicKey:  p.SSHPublicKey,
 		IsActive:      false,
 		CreatedFrom:   "clone",
+
+		SSHPrivateKeyRef: p.SSHPrivateKeyRef,
+		IdentityFile:     p.IdentityFile,
+		SSHCertificate:   p.SSHCertificate,
+		GitHubLogin:      p.GitHubLogin,
+
+		storage: p.storage,
 	}
 }
 
@@ -222,3 +656,64 @@ func (p *Profile) GetGitUsername() string {
 func (p *Profile) GetGitEmail() string {
 	return p.GitEmail
 }
+
+func (p *Profile) GetGitHubLogin() string {
+	return p.GitHubLogin
+}
+
+// GetSSHPrivateKey returns the private key, loading it from its key file or
+// secret backend if needed
+func (p *Profile) GetSSHPrivateKey() (string, error) {
+	if p.IdentityFile != "" {
+		data, err := os.ReadFile(p.IdentityFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read private key: %w", err)
+		}
+		return string(data), nil
+	}
+	if err := p.ResolvePrivateKey(); err != nil {
+		return "", err
+	}
+	return p.SSHPrivateKey, nil
+}
+
+// GetSSHPublicKey returns the public key, reading it from next to the key
+// file of a profile that uses one in place
+func (p *Profile) GetSSHPublicKey() (string, error) {
+	if p.IdentityFile != "" {
+		data, err := os.ReadFile(p.IdentityFile + ".pub")
+		if err != nil {
+			return "", fmt.Errorf("failed to read public key: %w", err)
+		}
+		return string(data), nil
+	}
+	return p.SSHPublicKey, nil
+}
+
+// WithInlineKeys returns a copy of p that holds its keys itself instead of
+// referring to key files or a secret backend, e.g. for an export
+func (p *Profile) WithInlineKeys() (*Profile, error) {
+	inline := *p
+	if p.IdentityFile != "" {
+		privateKey, err := p.GetSSHPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := p.GetSSHPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := p.GetSSHCertificate()
+		if err != nil {
+			return nil, err
+		}
+		inline.SSHPrivateKey = privateKey
+		inline.SSHPublicKey = publicKey
+		inline.SSHCertificate = certificate
+		inline.IdentityFile = ""
+	} else if err := inline.ResolvePrivateKey(); err != nil {
+		return nil, err
+	}
+	inline.SSHPrivateKeyRef = ""
+	return &inline, nil
+}
@@ -0,0 +1,75 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/huzaifanur/ghpm/internal/fsutil"
+)
+
+// validID matches the ids NewID generates; anything else could escape the
+// secrets directory
+var validID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// FileBackend keeps each secret in its own file, readable only by the user
+type FileBackend struct {
+	dir string
+}
+
+func NewFileBackend(dir string) *FileBackend {
+	return &FileBackend{dir: dir}
+}
+
+func (f *FileBackend) Name() string {
+	return FileBackendName
+}
+
+func (f *FileBackend) path(id string) (string, error) {
+	if !validID.MatchString(id) {
+		return "", fmt.Errorf("invalid secret id %q", id)
+	}
+	return filepath.Join(f.dir, id), nil
+}
+
+func (f *FileBackend) Store(id, label, secret string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	if err := fsutil.WriteFileAtomic(path, []byte(secret), 0600); err != nil {
+		return fmt.Errorf("failed to store secret: %w", err)
+	}
+	return nil
+}
+
+func (f *FileBackend) Lookup(id string) (string, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	return string(data), nil
+}
+
+func (f *FileBackend) Delete(id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete secret: %w", err)
+	}
+	return nil
+}
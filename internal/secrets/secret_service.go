@@ -0,0 +1,248 @@
+package secrets
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// D-Bus names of the freedesktop Secret Service API
+const (
+	secretServiceBusName = "org.freedesktop.secrets"
+	secretServicePath    = dbus.ObjectPath("/org/freedesktop/secrets")
+	secretInterface      = "org.freedesktop.Secret"
+)
+
+// promptTimeout bounds how long a keyring prompt, e.g. to unlock the
+// keyring, is waited for
+const promptTimeout = 2 * time.Minute
+
+// secretValue is the Secret struct of the Secret Service API, (oayays)
+type secretValue struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretService stores secrets in the user's default keyring through the
+// freedesktop Secret Service, as provided by GNOME Keyring or KWallet
+type SecretService struct {
+	conn *dbus.Conn
+}
+
+// NewSecretService uses the Secret Service reachable over conn
+func NewSecretService(conn *dbus.Conn) *SecretService {
+	return &SecretService{conn: conn}
+}
+
+// ConnectSecretService uses the Secret Service on the session bus
+func ConnectSecretService() (*SecretService, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the session bus: %w", err)
+	}
+	return NewSecretService(conn), nil
+}
+
+func (s *SecretService) Name() string {
+	return SecretServiceName
+}
+
+func (s *SecretService) Store(id, label, secret string) error {
+	collection, err := s.defaultCollection()
+	if err != nil {
+		return err
+	}
+	session, err := s.openSession()
+	if err != nil {
+		return err
+	}
+	defer s.closeSession(session)
+
+	properties := map[string]dbus.Variant{
+		secretInterface + ".Item.Label":      dbus.MakeVariant(label),
+		secretInterface + ".Item.Attributes": dbus.MakeVariant(itemAttributes(id)),
+	}
+	value := secretValue{
+		Session:     session,
+		Parameters:  []byte{},
+		Value:       []byte(secret),
+		ContentType: "text/plain",
+	}
+
+	var item, prompt dbus.ObjectPath
+	err = s.conn.Object(secretServiceBusName, collection).
+		Call(secretInterface+".Collection.CreateItem", 0, properties, value, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("failed to store secret in the keyring: %w", err)
+	}
+	return s.prompt(prompt)
+}
+
+func (s *SecretService) Lookup(id string) (string, error) {
+	items, err := s.search(id)
+	if err != nil {
+		return "", err
+	}
+	if len(items) == 0 {
+		return "", fmt.Errorf("%w in the keyring: %s", ErrNotFound, id)
+	}
+
+	session, err := s.openSession()
+	if err != nil {
+		return "", err
+	}
+	defer s.closeSession(session)
+
+	var secret secretValue
+	err = s.conn.Object(secretServiceBusName, items[0]).
+		Call(secretInterface+".Item.GetSecret", 0, session).
+		Store(&secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret from the keyring: %w", err)
+	}
+	return string(secret.Value), nil
+}
+
+func (s *SecretService) Delete(id string) error {
+	items, err := s.search(id)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		err := s.conn.Object(secretServiceBusName, item).
+			Call(secretInterface+".Item.Delete", 0).
+			Store(&prompt)
+		if err != nil {
+			return fmt.Errorf("failed to delete secret from the keyring: %w", err)
+		}
+		if err := s.prompt(prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// itemAttributes identify ghpm's keyring items
+func itemAttributes(id string) map[string]string {
+	return map[string]string{"application": "ghpm", "ghpm-id": id}
+}
+
+func (s *SecretService) service() dbus.BusObject {
+	return s.conn.Object(secretServiceBusName, secretServicePath)
+}
+
+// openSession opens a session without transport encryption; the secret
+// only travels over the local session bus
+func (s *SecretService) openSession() (dbus.ObjectPath, error) {
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err := s.service().
+		Call(secretInterface+".Service.OpenSession", 0, "plain", dbus.MakeVariant("")).
+		Store(&output, &session)
+	if err != nil {
+		return "", fmt.Errorf("failed to open a secret service session: %w", err)
+	}
+	return session, nil
+}
+
+func (s *SecretService) closeSession(session dbus.ObjectPath) {
+	s.conn.Object(secretServiceBusName, session).Call(secretInterface+".Session.Close", 0)
+}
+
+// defaultCollection returns the default keyring, unlocking it if needed
+func (s *SecretService) defaultCollection() (dbus.ObjectPath, error) {
+	var collection dbus.ObjectPath
+	err := s.service().Call(secretInterface+".Service.ReadAlias", 0, "default").Store(&collection)
+	if err != nil {
+		return "", fmt.Errorf("failed to find the default keyring: %w", err)
+	}
+	if collection == "/" {
+		return "", fmt.Errorf("the secret service has no default keyring")
+	}
+	if err := s.unlock([]dbus.ObjectPath{collection}); err != nil {
+		return "", err
+	}
+	return collection, nil
+}
+
+// search returns ghpm's items for id, unlocking locked ones
+func (s *SecretService) search(id string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := s.service().
+		Call(secretInterface+".Service.SearchItems", 0, itemAttributes(id)).
+		Store(&unlocked, &locked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search the keyring: %w", err)
+	}
+	if len(locked) > 0 {
+		if err := s.unlock(locked); err != nil {
+			return nil, err
+		}
+		unlocked = append(unlocked, locked...)
+	}
+	return unlocked, nil
+}
+
+func (s *SecretService) unlock(objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := s.service().
+		Call(secretInterface+".Service.Unlock", 0, objects).
+		Store(&unlocked, &prompt)
+	if err != nil {
+		return fmt.Errorf("failed to unlock the keyring: %w", err)
+	}
+	return s.prompt(prompt)
+}
+
+// prompt shows a Secret Service prompt, such as the keyring password
+// dialog, and waits until the user completes or dismisses it
+func (s *SecretService) prompt(prompt dbus.ObjectPath) error {
+	if prompt == "" || prompt == "/" {
+		return nil
+	}
+
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(secretInterface + ".Prompt"),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := s.conn.AddMatchSignal(match...); err != nil {
+		return fmt.Errorf("failed to watch the keyring prompt: %w", err)
+	}
+	defer s.conn.RemoveMatchSignal(match...)
+
+	signals := make(chan *dbus.Signal, 4)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	if err := s.conn.Object(secretServiceBusName, prompt).Call(secretInterface+".Prompt.Prompt", 0, "").Err; err != nil {
+		return fmt.Errorf("failed to show the keyring prompt: %w", err)
+	}
+
+	timeout := time.After(promptTimeout)
+	for {
+		select {
+		case signal, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("connection to the secret service closed")
+			}
+			if signal.Path != prompt || signal.Name != secretInterface+".Prompt.Completed" {
+				continue
+			}
+			if len(signal.Body) > 0 {
+				if dismissed, _ := signal.Body[0].(bool); dismissed {
+					return fmt.Errorf("the keyring prompt was dismissed")
+				}
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for the keyring prompt")
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package secrets
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// busConfig configures a private bus that lets the mock own any name
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:dir=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// startBus runs a private dbus-daemon for the test and returns its address
+func startBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "bus.conf")
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(busConfig, dir)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+configPath, "--nofork", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read the bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("failed to connect to the bus: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+const (
+	mockCollection = dbus.ObjectPath("/org/freedesktop/secrets/collection/login")
+	mockSession    = dbus.ObjectPath("/org/freedesktop/secrets/session/1")
+)
+
+type mockItem struct {
+	path       dbus.ObjectPath
+	attributes map[string]string
+	secret     []byte
+}
+
+// mockSecretService implements the parts of the Secret Service API the
+// backend uses. While locked, unlocking needs a prompt, which completes
+// with dismissed as its result.
+type mockSecretService struct {
+	conn *dbus.Conn
+
+	mu        sync.Mutex
+	items     map[dbus.ObjectPath]*mockItem
+	nextID    int
+	noDefault bool
+	locked    bool
+	dismissed bool
+	prompts   int
+}
+
+func startMockSecretService(t *testing.T, address string) *mockSecretService {
+	t.Helper()
+	conn := connect(t, address)
+	m := &mockSecretService{conn: conn, items: make(map[dbus.ObjectPath]*mockItem)}
+
+	exports := []struct {
+		v     any
+		path  dbus.ObjectPath
+		iface string
+	}{
+		{mockService{m}, secretServicePath, secretInterface + ".Service"},
+		{mockCollectionObject{m}, mockCollection, secretInterface + ".Collection"},
+		{mockSessionObject{}, mockSession, secretInterface + ".Session"},
+	}
+	for _, e := range exports {
+		if err := conn.Export(e.v, e.path, e.iface); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reply, err := conn.RequestName(secretServiceBusName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", secretServiceBusName, err)
+	}
+	return m
+}
+
+// newPrompt exports a prompt that runs done and then emits Completed
+func (m *mockSecretService) newPrompt(done func()) dbus.ObjectPath {
+	m.nextID++
+	m.prompts++
+	path := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/prompt/p%d", m.nextID))
+	m.conn.Export(mockPrompt{m: m, path: path, done: done}, path, secretInterface+".Prompt")
+	return path
+}
+
+func (m *mockSecretService) itemCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.items)
+}
+
+type mockService struct{ m *mockSecretService }
+
+func (s mockService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.MakeFailedError(fmt.Errorf("unsupported algorithm %s", algorithm))
+	}
+	return dbus.MakeVariant(""), mockSession, nil
+}
+
+func (s mockService) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if name != "default" || s.m.noDefault {
+		return "/", nil
+	}
+	return mockCollection, nil
+}
+
+func (s mockService) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var unlocked, locked []dbus.ObjectPath
+	for path, item := range s.m.items {
+		if !matches(item.attributes, attributes) {
+			continue
+		}
+		if s.m.locked {
+			locked = append(locked, path)
+		} else {
+			unlocked = append(unlocked, path)
+		}
+	}
+	return unlocked, locked, nil
+}
+
+func (s mockService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if !s.m.locked {
+		return objects, "/", nil
+	}
+	prompt := s.m.newPrompt(func() {
+		if !s.m.dismissed {
+			s.m.locked = false
+		}
+	})
+	return nil, prompt, nil
+}
+
+func matches(attributes, query map[string]string) bool {
+	for k, v := range query {
+		if attributes[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+type mockCollectionObject struct{ m *mockSecretService }
+
+func (c mockCollectionObject) CreateItem(properties map[string]dbus.Variant, secret secretValue, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	m := c.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked {
+		return "", "", &dbus.Error{Name: secretInterface + ".Error.IsLocked"}
+	}
+	if secret.Session != mockSession {
+		return "", "", &dbus.Error{Name: secretInterface + ".Error.NoSession"}
+	}
+
+	var attributes map[string]string
+	if err := properties[secretInterface+".Item.Attributes"].Store(&attributes); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+	if replace {
+		for path, item := range m.items {
+			if matches(item.attributes, attributes) && matches(attributes, item.attributes) {
+				item.secret = secret.Value
+				return path, "/", nil
+			}
+		}
+	}
+
+	m.nextID++
+	path := dbus.ObjectPath(fmt.Sprintf("%s/i%d", mockCollection, m.nextID))
+	item := &mockItem{path: path, attributes: attributes, secret: secret.Value}
+	m.items[path] = item
+	m.conn.Export(mockItemObject{m: m, item: item}, path, secretInterface+".Item")
+	return path, "/", nil
+}
+
+type mockItemObject struct {
+	m    *mockSecretService
+	item *mockItem
+}
+
+func (i mockItemObject) GetSecret(session dbus.ObjectPath) (secretValue, *dbus.Error) {
+	i.m.mu.Lock()
+	defer i.m.mu.Unlock()
+	if i.m.locked {
+		return secretValue{}, &dbus.Error{Name: secretInterface + ".Error.IsLocked"}
+	}
+	return secretValue{Session: session, Parameters: []byte{}, Value: i.item.secret, ContentType: "text/plain"}, nil
+}
+
+func (i mockItemObject) Delete() (dbus.ObjectPath, *dbus.Error) {
+	i.m.mu.Lock()
+	defer i.m.mu.Unlock()
+	delete(i.m.items, i.item.path)
+	i.m.conn.Export(nil, i.item.path, secretInterface+".Item")
+	return "/", nil
+}
+
+type mockSessionObject struct{}
+
+func (mockSessionObject) Close() *dbus.Error {
+	return nil
+}
+
+type mockPrompt struct {
+	m    *mockSecretService
+	path dbus.ObjectPath
+	done func()
+}
+
+func (p mockPrompt) Prompt(windowID string) *dbus.Error {
+	go func() {
+		p.m.mu.Lock()
+		p.done()
+		dismissed := p.m.dismissed
+		p.m.mu.Unlock()
+		p.m.conn.Emit(p.path, secretInterface+".Prompt.Completed", dismissed, dbus.MakeVariant(""))
+	}()
+	return nil
+}
+
+func TestSecretServiceStoreLookupDelete(t *testing.T) {
+	address := startBus(t)
+	mock := startMockSecretService(t, address)
+	s := NewSecretService(connect(t, address))
+
+	if err := s.Store("a", "key a", "secret a"); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if err := s.Store("b", "key b", "secret b"); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if err := s.Store("a", "key a", "secret a2"); err != nil {
+		t.Fatalf("Store replacing a secret: %v", err)
+	}
+	if n := mock.itemCount(); n != 2 {
+		t.Errorf("keyring holds %d items, want 2", n)
+	}
+
+	for id, want := range map[string]string{"a": "secret a2", "b": "secret b"} {
+		got, err := s.Lookup(id)
+		if err != nil {
+			t.Fatalf("Lookup(%q): %v", id, err)
+		}
+		if got != want {
+			t.Errorf("Lookup(%q) = %q, want %q", id, got, want)
+		}
+	}
+
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Lookup("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup after Delete: got %v, want ErrNotFound", err)
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Errorf("Delete of a missing secret: %v", err)
+	}
+	if got, err := s.Lookup("b"); err != nil || got != "secret b" {
+		t.Errorf("Lookup(%q) after deleting another secret = %q, %v", "b", got, err)
+	}
+}
+
+func TestSecretServiceLockedKeyring(t *testing.T) {
+	tests := []struct {
+		name      string
+		dismissed bool
+		wantErr   string
+	}{
+		{name: "unlocked by the prompt"},
+		{name: "prompt dismissed", dismissed: true, wantErr: "dismissed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := startBus(t)
+			mock := startMockSecretService(t, address)
+			s := NewSecretService(connect(t, address))
+
+			if err := s.Store("a", "key a", "secret a"); err != nil {
+				t.Fatalf("Store: %v", err)
+			}
+			mock.mu.Lock()
+			mock.locked = true
+			mock.dismissed = tt.dismissed
+			mock.mu.Unlock()
+
+			got, err := s.Lookup("a")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Lookup: got %v, want an error containing %q", err, tt.wantErr)
+				}
+			} else if err != nil || got != "secret a" {
+				t.Fatalf("Lookup = %q, %v, want %q", got, err, "secret a")
+			}
+			mock.mu.Lock()
+			defer mock.mu.Unlock()
+			if mock.prompts != 1 {
+				t.Errorf("showed %d prompts, want 1", mock.prompts)
+			}
+		})
+	}
+}
+
+func TestSecretServiceNoDefaultKeyring(t *testing.T) {
+	address := startBus(t)
+	mock := startMockSecretService(t, address)
+	mock.mu.Lock()
+	mock.noDefault = true
+	mock.mu.Unlock()
+	s := NewSecretService(connect(t, address))
+
+	err := s.Store("a", "key a", "secret a")
+	if err == nil || !strings.Contains(err.Error(), "no default keyring") {
+		t.Fatalf("Store: got %v, want a missing default keyring error", err)
+	}
+}
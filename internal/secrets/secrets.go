@@ -0,0 +1,98 @@
+// Package secrets keeps private keys outside the profile files, in a secret
+// backend such as the freedesktop Secret Service. A profile then only holds
+// a reference of the form "<backend>:<id>".
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Backend names, as used in references and the secret_backend setting
+const (
+	FileBackendName   = "file"
+	SecretServiceName = "secret-service"
+)
+
+// ErrNotFound is returned when a backend holds no secret with the given id
+var ErrNotFound = errors.New("secret not found")
+
+// Backend stores secrets under an id chosen by the caller
+type Backend interface {
+	Name() string
+	// Store saves secret under id, replacing an existing one; label is shown
+	// to the user by backends that have a user interface
+	Store(id, label, secret string) error
+	Lookup(id string) (string, error)
+	// Delete removes the secret; a missing secret is not an error
+	Delete(id string) error
+}
+
+// Open returns the backend with the given name; the file backend keeps its
+// secrets in dir
+func Open(name, dir string) (Backend, error) {
+	switch name {
+	case FileBackendName:
+		return NewFileBackend(dir), nil
+	case SecretServiceName:
+		return ConnectSecretService()
+	default:
+		return nil, fmt.Errorf("unknown secret backend %q", name)
+	}
+}
+
+// NewID returns a random id for a new secret
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Ref returns the reference to secret id in backend
+func Ref(backend, id string) string {
+	return backend + ":" + id
+}
+
+// ParseRef splits a reference into backend name and id
+func ParseRef(ref string) (backend, id string, err error) {
+	backend, id, found := strings.Cut(ref, ":")
+	if !found || backend == "" || id == "" {
+		return "", "", fmt.Errorf("malformed secret reference %q", ref)
+	}
+	return backend, id, nil
+}
+
+// Lookup returns the secret a reference points to; dir is as for Open
+func Lookup(ref, dir string) (string, error) {
+	backend, id, err := open(ref, dir)
+	if err != nil {
+		return "", err
+	}
+	return backend.Lookup(id)
+}
+
+// Delete removes the secret a reference points to; dir is as for Open
+func Delete(ref, dir string) error {
+	backend, id, err := open(ref, dir)
+	if err != nil {
+		return err
+	}
+	return backend.Delete(id)
+}
+
+func open(ref, dir string) (Backend, string, error) {
+	name, id, err := ParseRef(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	backend, err := Open(name, dir)
+	if err != nil {
+		return nil, "", err
+	}
+	return backend, id, nil
+}
@@ -1,37 +1,85 @@
 package actions
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
 	"github.com/huzaifanur/ghpm/internal/config"
 	"github.com/huzaifanur/ghpm/internal/git"
 	"github.com/huzaifanur/ghpm/internal/profile"
+	"github.com/huzaifanur/ghpm/internal/ui/dialogs"
 	"github.com/huzaifanur/ghpm/pkg/logger"
 )
 
+const switchPermanently = "Until switched again"
+
+// temporaryDurations are offered for a temporary switch
+var temporaryDurations = []time.Duration{
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+	4 * time.Hour,
+	8 * time.Hour,
+}
+
 type ProfileActions struct {
 	window     fyne.Window
 	config     *config.Config
 	gitManager *git.Manager
 	logger     *logger.Logger
+
+	// state of ending a temporary switch, only touched on the UI thread
+	reverting bool
+	// expiry of a temporary switch that could not be reverted automatically,
+	// so the revert is not retried on every tick
+	revertFailedAt time.Time
 }
 
 func NewProfileActions(window fyne.Window, config *config.Config, gitManager *git.Manager, logger *logger.Logger) *ProfileActions {
-	return &ProfileActions{
+	pa := &ProfileActions{
 		window:     window,
 		config:     config,
 		gitManager: gitManager,
 		logger:     logger,
 	}
+	gitManager.SetPassphrasePrompt(pa.promptPassphrase)
+	return pa
+}
+
+// promptPassphrase asks for the passphrase of a profile's private key. It is
+// called from a switch running in the background and blocks until the
+// dialog is closed.
+func (pa *ProfileActions) promptPassphrase(profileName string, attempt int) (string, error) {
+	text := fmt.Sprintf("The SSH key of profile '%s' is passphrase protected.\n"+
+		"The passphrase only unlocks the key into ssh-agent and is never stored.", profileName)
+	if attempt > 1 {
+		text = "Incorrect passphrase, try again.\n\n" + text
+	}
+	return dialogs.AskPassword(pa.window, "Unlock SSH Key", "Unlock", text)
 }
 
 func (pa *ProfileActions) SetConfig(cfg *config.Config) {
 	pa.config = cfg
 }
 
+// Sync updates profile key files, SSH host aliases and git includes after
+// profiles were added, changed or removed
+func (pa *ProfileActions) Sync() {
+	if err := pa.config.Sync(pa.gitManager); err != nil {
+		pa.logger.Errorw("Failed to sync profiles to the system", "error", err)
+		dialog.ShowError(fmt.Errorf("failed to sync profiles to the system: %w", err), pa.window)
+	}
+}
+
 func (pa *ProfileActions) Import(onComplete func()) {
 	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
 		if err != nil || reader == nil {
@@ -46,6 +94,7 @@ func (pa *ProfileActions) Import(onComplete func()) {
 			dialog.ShowError(err, pa.window)
 			return
 		}
+		pa.Sync()
 
 		onComplete()
 		pa.logger.Infow("Imported profile", "name", importedProfile.Name, "path", filePath)
@@ -97,8 +146,12 @@ func (pa *ProfileActions) Delete(selectedProfile *profile.Profile, onComplete fu
 
 			if err := pa.config.DeleteProfile(selectedProfile.Name); err != nil {
 				dialog.ShowError(err, pa.window)
-				return
+				if !config.IsUnusedSecret(err) {
+					return
+				}
+				pa.logger.Warnw("Deleted profile but kept its private key", "error", err)
 			}
+			pa.Sync()
 
 			onComplete()
 			pa.logger.Infow("Deleted profile", "name", selectedProfile.Name)
@@ -115,61 +168,295 @@ func (pa *ProfileActions) Switch(selectedProfile *profile.Profile, onComplete fu
 		selectedProfile.Name, selectedProfile.GitUsername, selectedProfile.GitEmail)
 
 	if selectedProfile.HasSSHKeys() {
-		message += "\n• Replace SSH keys with profile keys"
+		if selectedProfile.HasEncryptedKey() {
+			message += "\n• Ask for the key's passphrase and unlock it into ssh-agent"
+		}
+		if pa.gitManager.SSHKeyStrategy() == git.SSHKeyStrategyAgent {
+			message += fmt.Sprintf("\n• Load SSH key %s into ssh-agent for github.com", selectedProfile.SSHKeyName())
+		} else {
+			message += fmt.Sprintf("\n• Use SSH key %s for github.com", selectedProfile.SSHKeyPath())
+		}
+	}
+
+	messageLabel := widget.NewLabel(message)
+	durations := []string{switchPermanently}
+	for _, d := range temporaryDurations {
+		durations = append(durations, "For "+formatDuration(d))
 	}
+	durationSelect := widget.NewSelect(durations, nil)
+	durationSelect.SetSelectedIndex(0)
+	content := container.NewVBox(messageLabel, widget.NewForm(widget.NewFormItem("Duration", durationSelect)))
 
-	dialog.ShowConfirm("Switch Profile", message, func(confirm bool) {
+	dialog.ShowCustomConfirm("Switch Profile", "Switch", "Cancel", content, func(confirm bool) {
 		if !confirm {
 			return
 		}
+		var duration time.Duration
+		if i := durationSelect.SelectedIndex(); i > 0 {
+			duration = temporaryDurations[i-1]
+		}
+		pa.applySwitch(selectedProfile, false, duration, onComplete)
+	}, pa.window)
+}
 
-		progressDlg := dialog.NewProgressInfinite("Switching Profile", "Configuring git and SSH...", pa.window)
-		progressDlg.Show()
+// UndoSwitch switches back to the profile that was active before the last switch
+func (pa *ProfileActions) UndoSwitch(onComplete func()) {
+	previous, err := pa.config.PreviousProfile()
+	if err != nil {
+		dialog.ShowInformation("Nothing to Undo", fmt.Sprintf("Cannot undo the last switch: %v", err), pa.window)
+		return
+	}
 
-		go func() {
-			err := pa.gitManager.SwitchProfile(selectedProfile)
+	dialog.ShowConfirm("Undo Last Switch",
+		fmt.Sprintf("Switch back to profile '%s' (%s <%s>)?", previous.Name, previous.GitUsername, previous.GitEmail),
+		func(confirm bool) {
+			if !confirm {
+				return
+			}
+			pa.applySwitch(previous, true, 0, onComplete)
+		}, pa.window)
+}
 
-			fyne.DoAndWait(func() {
-				progressDlg.Hide()
+// EndTemporarySwitch restores the profile that was active before the running
+// temporary switch. expired marks the automatic revert once its time is up.
+func (pa *ProfileActions) EndTemporarySwitch(expired bool, onComplete func()) {
+	if pa.reverting {
+		return
+	}
+	pa.reverting = true
 
-				if err != nil {
-					dialog.ShowError(fmt.Errorf("failed to switch profile: %w", err), pa.window)
-					return
-				}
+	var expiresAt time.Time
+	if running, err := pa.config.TemporarySwitch(); err == nil && running != nil {
+		expiresAt = running.ExpiresAt
+	}
 
-				if err := pa.config.SetActiveProfile(selectedProfile.Name); err != nil {
-					dialog.ShowError(err, pa.window)
-					return
-				}
+	opts := pa.switchOptions(false, 0)
+	if expired {
+		opts.Source = config.SwitchSourceTimer
+	}
 
-				onComplete()
+	ctx, cancel := context.WithCancel(context.Background())
+	progressDlg := dialogs.NewProgressDialog(pa.window, "Ending Temporary Switch", "Restoring the previous profile...", cancel)
+	progressDlg.Show()
+
+	go func() {
+		defer cancel()
+		restored, err := pa.config.EndTemporarySwitch(ctx, pa.gitManager, opts)
 
-				successMsg := fmt.Sprintf("Switched to profile '%s'", selectedProfile.Name)
-				if selectedProfile.HasSSHKeys() {
-					successMsg += "\nSSH keys have been configured"
+		fyne.DoAndWait(func() {
+			progressDlg.Hide()
+			pa.reverting = false
+
+			if err != nil {
+				pa.logger.Errorw("Failed to end temporary switch", "error", err)
+				pa.showSwitchError(err)
+				if expired {
+					pa.revertFailedAt = expiresAt
 				}
+				onComplete()
+				return
+			}
 
-				dialog.ShowInformation("Success", successMsg, pa.window)
-			})
-		}()
-	}, pa.window)
+			onComplete()
+			message := fmt.Sprintf("Restored profile '%s'", restored.Name)
+			if expired {
+				message = "The temporary switch has expired.\n" + message
+			}
+			dialog.ShowInformation("Temporary Switch Ended", message, pa.window)
+		})
+	}()
 }
 
-func (pa *ProfileActions) TestSSH() {
-	progressDlg := dialog.NewProgressInfinite("Testing SSH", "Testing SSH connection to GitHub...", pa.window)
+// RevertExpired ends the temporary switch t if its time is up. It is called
+// on every tick of the status countdown; a failed revert is retried only
+// after a restart.
+func (pa *ProfileActions) RevertExpired(t *config.TemporarySwitch, onComplete func()) {
+	if t == nil || !t.Expired(time.Now()) || t.ExpiresAt.Equal(pa.revertFailedAt) {
+		return
+	}
+	pa.EndTemporarySwitch(true, onComplete)
+}
+
+func (pa *ProfileActions) switchOptions(undo bool, duration time.Duration) config.SwitchOptions {
+	return config.SwitchOptions{
+		Source:   config.SwitchSourceGUI,
+		Undo:     undo,
+		Duration: duration,
+		// activation touches shared config state, so it runs on the UI thread
+		Run: fyne.DoAndWait,
+		Warn: func(err error) {
+			pa.logger.Warnw("Problem after switching profile", "error", err)
+		},
+	}
+}
+
+// applySwitch switches to target in the background; a non-zero duration
+// makes the switch temporary
+func (pa *ProfileActions) applySwitch(target *profile.Profile, undo bool, duration time.Duration, onComplete func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	progressDlg := dialogs.NewProgressDialog(pa.window, "Switching Profile", "Configuring git and SSH...", cancel)
 	progressDlg.Show()
 
+	opts := pa.switchOptions(undo, duration)
 	go func() {
-		err := pa.gitManager.TestSSHConnection()
+		defer cancel()
+		err := pa.config.Switch(ctx, pa.gitManager, target, opts)
 
 		fyne.DoAndWait(func() {
 			progressDlg.Hide()
 
 			if err != nil {
-				dialog.ShowError(fmt.Errorf("SSH test failed: %w", err), pa.window)
-			} else {
-				dialog.ShowInformation("Success", "SSH connection to GitHub successful!", pa.window)
+				pa.showSwitchError(err)
+				return
 			}
+
+			onComplete()
+
+			successMsg := fmt.Sprintf("Switched to profile '%s'", target.Name)
+			if duration > 0 {
+				successMsg += fmt.Sprintf(" for %s", formatDuration(duration))
+			}
+			if target.HasSSHKeys() {
+				successMsg += "\nSSH keys have been configured"
+			}
+
+			dialog.ShowInformation("Success", successMsg, pa.window)
 		})
 	}()
 }
+
+// showSwitchError reports a failed switch together with what was rolled back
+func (pa *ProfileActions) showSwitchError(err error) {
+	var switchErr *git.SwitchError
+	if !errors.As(err, &switchErr) {
+		dialog.ShowError(fmt.Errorf("failed to switch profile: %w", err), pa.window)
+		return
+	}
+
+	title := "Switch Failed"
+	message := fmt.Sprintf("Switching to '%s' failed while %s:\n%v\n\n", switchErr.Profile, switchErr.Step, switchErr.Err)
+	if errors.Is(switchErr.Err, context.Canceled) {
+		title = "Switch Cancelled"
+		message = fmt.Sprintf("Switching to '%s' was cancelled while %s.\n\n", switchErr.Profile, switchErr.Step)
+	}
+	if hint := git.Remediation(switchErr.Err); hint != "" {
+		message += hint + "\n\n"
+	}
+	switch {
+	case len(switchErr.RollbackErrors) > 0:
+		message += "Some changes could not be rolled back:\n"
+		for _, rollbackErr := range switchErr.RollbackErrors {
+			message += "• " + rollbackErr.Error() + "\n"
+		}
+		if len(switchErr.RolledBack) > 0 {
+			message += "\nRestored:\n• " + strings.Join(switchErr.RolledBack, "\n• ")
+		}
+	case len(switchErr.RolledBack) > 0:
+		message += "All changes were rolled back; the previous profile is still active.\nRestored:\n• " +
+			strings.Join(switchErr.RolledBack, "\n• ")
+	default:
+		message += "Nothing was changed."
+	}
+
+	label := widget.NewLabel(message)
+	label.Wrapping = fyne.TextWrapWord
+	dlg := dialog.NewCustom(title, "OK", container.NewVScroll(label), pa.window)
+	dlg.Resize(fyne.NewSize(600, 400))
+	dlg.Show()
+}
+
+func (pa *ProfileActions) TestSSH() {
+	ctx, cancel := context.WithCancel(context.Background())
+	progressDlg := dialogs.NewProgressDialog(pa.window, "Testing SSH", "Testing SSH connection to GitHub...", cancel)
+	progressDlg.Show()
+
+	// the active profile's key must belong to the account it names
+	expectedLogin := ""
+	if active := pa.config.GetActiveProfile(); active != nil {
+		expectedLogin = active.GitHubLogin
+	}
+
+	go func() {
+		defer cancel()
+		login, err := pa.gitManager.TestSSHConnection(ctx, expectedLogin)
+
+		fyne.DoAndWait(func() {
+			progressDlg.Hide()
+
+			var wrongAccountErr *git.WrongAccountError
+			switch {
+			case errors.Is(err, context.Canceled):
+				// stopped with the Cancel button; nothing to report
+			case errors.As(err, &wrongAccountErr):
+				pa.showWrongAccount(wrongAccountErr)
+			case err != nil:
+				pa.showSSHTestError(err)
+			case expectedLogin != "":
+				dialog.ShowInformation("Success", fmt.Sprintf("SSH connection to GitHub successful!\nAuthenticated as '%s', as the profile expects.", login), pa.window)
+			default:
+				dialog.ShowInformation("Success", fmt.Sprintf("SSH connection to GitHub successful!\nAuthenticated as '%s'.", login), pa.window)
+			}
+		})
+	}()
+}
+
+// sshTestErrorTitles name the dialog for the kinds of failure
+var sshTestErrorTitles = []struct {
+	kind  error
+	title string
+}{
+	{git.ErrHostKeyMismatch, "GitHub Could Not Be Verified"},
+	{git.ErrAuthFailed, "SSH Authentication Failed"},
+	{git.ErrNetworkUnreachable, "GitHub Unreachable"},
+	{git.ErrTimeout, "Connection Timed Out"},
+	{git.ErrSSHNotFound, "SSH Not Installed"},
+}
+
+// showSSHTestError reports a failed SSH test with advice for its kind
+func (pa *ProfileActions) showSSHTestError(err error) {
+	title := "SSH Test Failed"
+	for _, t := range sshTestErrorTitles {
+		if errors.Is(err, t.kind) {
+			title = t.title
+			break
+		}
+	}
+
+	message := err.Error()
+	if hint := git.Remediation(err); hint != "" {
+		message += "\n\n" + hint
+	}
+	label := widget.NewLabel(message)
+	label.Wrapping = fyne.TextWrapWord
+	content := container.NewBorder(nil, nil, widget.NewIcon(theme.ErrorIcon()), nil, label)
+	dlg := dialog.NewCustom(title, "OK", content, pa.window)
+	dlg.Resize(fyne.NewSize(500, 220))
+	dlg.Show()
+}
+
+// showWrongAccount tells that the key works, but for another account than
+// the active profile's
+func (pa *ProfileActions) showWrongAccount(err *git.WrongAccountError) {
+	label := widget.NewLabel(fmt.Sprintf("The SSH key works, but GitHub authenticated it as '%s', not as '%s'.\n\n"+
+		"Pushes would be made as '%s'. Check that the profile has the right key, or correct its GitHub login.",
+		err.Login, err.Expected, err.Login))
+	label.Wrapping = fyne.TextWrapWord
+	content := container.NewBorder(nil, nil, widget.NewIcon(theme.WarningIcon()), nil, label)
+	dlg := dialog.NewCustom("Wrong GitHub Account", "OK", content, pa.window)
+	dlg.Resize(fyne.NewSize(500, 200))
+	dlg.Show()
+}
+
+// formatDuration renders whole hours and minutes, e.g. "2h" or "1h 30m"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%dh", hours)
+	default:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+}
@@ -0,0 +1,106 @@
+package dialogs
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/huzaifanur/ghpm/internal/config"
+	"github.com/huzaifanur/ghpm/pkg/logger"
+)
+
+type BackupDialog struct {
+	window fyne.Window
+	config *config.Config
+	logger *logger.Logger
+}
+
+func NewBackupDialog(window fyne.Window, config *config.Config, logger *logger.Logger) *BackupDialog {
+	return &BackupDialog{
+		window: window,
+		config: config,
+		logger: logger,
+	}
+}
+
+func (bd *BackupDialog) SetConfig(cfg *config.Config) {
+	bd.config = cfg
+}
+
+func (bd *BackupDialog) Show(onRestored func()) {
+	store := bd.config.BackupStore()
+	snapshots, err := store.List()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("failed to list backups: %w", err), bd.window)
+		return
+	}
+
+	if len(snapshots) == 0 {
+		dialog.ShowInformation("Restore Backup",
+			"No backups yet.\nghpm backs up SSH key files before it overwrites or removes them.",
+			bd.window)
+		return
+	}
+
+	details := widget.NewLabel("Select a backup to see its files")
+	details.Wrapping = fyne.TextWrapWord
+
+	selected := -1
+	list := widget.NewList(
+		func() int {
+			return len(snapshots)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Backup")
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			snap := snapshots[i]
+			o.(*widget.Label).SetText(fmt.Sprintf("%s — %s", snap.CreatedAt.Format("2006-01-02 15:04:05"), snap.Reason))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		selected = id
+		var paths []string
+		for _, f := range snapshots[id].Files {
+			paths = append(paths, "• "+f.Path)
+		}
+		details.SetText("Restores:\n" + strings.Join(paths, "\n"))
+	}
+
+	content := container.NewBorder(nil, widget.NewCard("Files", "", details), nil, nil, list)
+
+	dlg := dialog.NewCustomConfirm("Restore Backup", "Restore", "Close", content, func(restore bool) {
+		if !restore {
+			return
+		}
+		if selected < 0 {
+			dialog.ShowInformation("No Selection", "Please select a backup to restore", bd.window)
+			return
+		}
+
+		snap := snapshots[selected]
+		dialog.ShowConfirm("Restore Backup",
+			fmt.Sprintf("Restore %d file(s) from %s?\nCurrent versions of these files are backed up first.",
+				len(snap.Files), snap.CreatedAt.Format("2006-01-02 15:04:05")),
+			func(confirm bool) {
+				if !confirm {
+					return
+				}
+
+				if _, err := store.Restore(snap.ID); err != nil {
+					dialog.ShowError(fmt.Errorf("failed to restore backup: %w", err), bd.window)
+					return
+				}
+
+				onRestored()
+				bd.logger.Infow("Restored backup", "id", snap.ID)
+				dialog.ShowInformation("Success", fmt.Sprintf("Restored backup %s", snap.ID), bd.window)
+			}, bd.window)
+	}, bd.window)
+
+	dlg.Resize(fyne.NewSize(700, 500))
+	dlg.Show()
+}
@@ -31,7 +31,7 @@ func (dd *DetectDialog) SetConfig(cfg *config.Config) {
 }
 
 func (dd *DetectDialog) Show(onProfileCreated func()) {
-    detectedProfile, err := profile.CreateFromSystem("temp")
+    detectedProfile, err := profile.CreateFromSystem("temp", false)
     if err != nil {
         dialog.ShowError(fmt.Errorf("failed to detect configuration: %w", err), dd.window)
         dialog.ShowInformation(
@@ -59,9 +59,12 @@ func (dd *DetectDialog) Show(onProfileCreated func()) {
 	previewLabel := widget.NewLabel(previewText)
 	previewLabel.Wrapping = fyne.TextWrapWord
 
+	inPlaceCheck := widget.NewCheck("Use the key files in place instead of copying them", nil)
+
 	form := container.NewVBox(
 		widget.NewForm(widget.NewFormItem("Profile Name", nameEntry)),
 		widget.NewCard("Preview", "", previewLabel),
+		inPlaceCheck,
 	)
 
 	dlg := dialog.NewCustomConfirm("Detect Current Configuration", "Create", "Cancel", form, func(create bool) {
@@ -74,6 +77,16 @@ func (dd *DetectDialog) Show(onProfileCreated func()) {
 			return
 		}
 
+		if inPlaceCheck.Checked {
+			// the key files must pass the permission checks to be used in place
+			inPlaceProfile, err := profile.CreateFromSystem(nameEntry.Text, true)
+			if err != nil {
+				dialog.ShowError(err, dd.window)
+				return
+			}
+			detectedProfile = inPlaceProfile
+		}
+
 		detectedProfile.Name = nameEntry.Text
 		if err := dd.config.AddProfile(detectedProfile); err != nil {
 			dialog.ShowError(err, dd.window)
@@ -0,0 +1,73 @@
+package dialogs
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/huzaifanur/ghpm/internal/config"
+)
+
+type HistoryDialog struct {
+	window fyne.Window
+	config *config.Config
+}
+
+func NewHistoryDialog(window fyne.Window, config *config.Config) *HistoryDialog {
+	return &HistoryDialog{
+		window: window,
+		config: config,
+	}
+}
+
+func (hd *HistoryDialog) SetConfig(cfg *config.Config) {
+	hd.config = cfg
+}
+
+// Show lists recent switches; onUndo is called when the user asks to undo
+// the last one
+func (hd *HistoryDialog) Show(onUndo func()) {
+	records, err := hd.config.SwitchHistory()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("failed to read switch history: %w", err), hd.window)
+		return
+	}
+
+	if len(records) == 0 {
+		dialog.ShowInformation("Switch History", "No profile switches recorded yet.", hd.window)
+		return
+	}
+
+	list := widget.NewList(
+		func() int {
+			return len(records)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Switch")
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			r := records[i]
+			from := r.From
+			if from == "" {
+				from = "(none)"
+			}
+			text := fmt.Sprintf("%s — %s → %s (%s)", r.Time.Local().Format("2006-01-02 15:04:05"), from, r.To, r.Source)
+			if r.Undo {
+				text += " — undo"
+			}
+			if r.Until != nil {
+				text += " — until " + r.Until.Local().Format("15:04")
+			}
+			o.(*widget.Label).SetText(text)
+		},
+	)
+
+	dlg := dialog.NewCustomConfirm("Switch History", "Undo Last Switch", "Close", list, func(undo bool) {
+		if undo {
+			onUndo()
+		}
+	}, hd.window)
+	dlg.Resize(fyne.NewSize(700, 500))
+	dlg.Show()
+}
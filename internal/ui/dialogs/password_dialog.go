@@ -0,0 +1,43 @@
+package dialogs
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// AskPassword shows a dialog with a hidden entry and returns what was
+// entered. It must be called from a background goroutine, never the UI
+// thread, as it blocks until the dialog is closed.
+func AskPassword(window fyne.Window, title, confirm, text string) (string, error) {
+	result := make(chan *string, 1)
+
+	fyne.Do(func() {
+		entry := widget.NewPasswordEntry()
+		dlg := dialog.NewCustomConfirm(title, confirm, "Cancel",
+			container.NewVBox(widget.NewLabel(text), entry),
+			func(ok bool) {
+				if !ok {
+					result <- nil
+					return
+				}
+				password := entry.Text
+				result <- &password
+			}, window)
+		entry.OnSubmitted = func(string) {
+			dlg.Confirm()
+		}
+		dlg.Resize(fyne.NewSize(500, 200))
+		dlg.Show()
+		window.Canvas().Focus(entry)
+	})
+
+	password := <-result
+	if password == nil {
+		return "", fmt.Errorf("passphrase entry cancelled")
+	}
+	return *password, nil
+}
@@ -3,6 +3,8 @@ package dialogs
 import (
     "fmt"
     "io"
+    "strings"
+    "time"
 
     "fyne.io/fyne/v2"
     "fyne.io/fyne/v2/container"
@@ -28,26 +30,58 @@ func (pd *ProfileDialog) Show(editProfile *profile.Profile, title string, onSave
 	nameEntry := widget.NewEntry()
 	usernameEntry := widget.NewEntry()
 	emailEntry := widget.NewEntry()
+	loginEntry := widget.NewEntry()
+	loginEntry.SetPlaceHolder("Optional; checked by Test SSH")
 
 	privateKeyLabel := widget.NewLabel("No private key")
 	privateKeyLabel.Wrapping = fyne.TextWrapWord
 	publicKeyLabel := widget.NewLabel("No public key")
 	publicKeyLabel.Wrapping = fyne.TextWrapWord
+	certificateLabel := widget.NewLabel("No certificate (optional)")
+	certificateLabel.Wrapping = fyne.TextWrapWord
 
-	var privateKeyContent, publicKeyContent string
+	directoriesEntry := widget.NewMultiLineEntry()
+	directoriesEntry.SetPlaceHolder("One directory per line, e.g. ~/work")
+	directoriesEntry.SetMinRowsVisible(3)
+
+	remoteURLsEntry := widget.NewMultiLineEntry()
+	remoteURLsEntry.SetPlaceHolder("One pattern per line, e.g. git@github.com:acme-corp/**")
+	remoteURLsEntry.SetMinRowsVisible(2)
+
+	var privateKeyContent, publicKeyContent, certificateContent string
+	// a key kept in a secret backend stays there unless another is loaded
+	var privateKeyRef string
+	// the file the private key was selected from, for using it in place
+	var privateKeyPath string
+
+	inPlaceCheck := widget.NewCheck("Use the selected key file in place instead of copying it", nil)
 
 	if editProfile != nil {
 		nameEntry.SetText(editProfile.Name)
 		usernameEntry.SetText(editProfile.GitUsername)
 		emailEntry.SetText(editProfile.GitEmail)
+		loginEntry.SetText(editProfile.GitHubLogin)
+		directoriesEntry.SetText(strings.Join(editProfile.Directories, "\n"))
+		remoteURLsEntry.SetText(strings.Join(editProfile.RemoteURLs, "\n"))
 		privateKeyContent = editProfile.SSHPrivateKey
+		privateKeyRef = editProfile.SSHPrivateKeyRef
 		publicKeyContent = editProfile.SSHPublicKey
+		certificateContent = editProfile.SSHCertificate
+		if certificateContent != "" {
+			certificateLabel.SetText(certificateSummary(certificateContent))
+		}
 
-		if privateKeyContent != "" {
+		if privateKeyContent != "" || privateKeyRef != "" {
 			privateKeyLabel.SetText("Private key loaded from profile")
 		}
 		if publicKeyContent != "" {
-			publicKeyLabel.SetText("Public key loaded from profile")
+			publicKeyLabel.SetText("Public key loaded from profile" + publicKeyTypeSuffix(publicKeyContent))
+		}
+		if editProfile.IsReference() {
+			privateKeyPath = editProfile.IdentityFile
+			privateKeyLabel.SetText(fmt.Sprintf("Using: %s", privateKeyPath))
+			publicKeyLabel.SetText(fmt.Sprintf("Using: %s.pub", privateKeyPath))
+			inPlaceCheck.SetChecked(true)
 		}
 	}
 
@@ -70,7 +104,8 @@ func (pd *ProfileDialog) Show(editProfile *profile.Profile, title string, onSave
 			}
 
 			privateKeyContent = keyContent
-			privateKeyLabel.SetText(fmt.Sprintf("Loaded: %s", reader.URI().Path()))
+			privateKeyPath = reader.URI().Path()
+			privateKeyLabel.SetText(fmt.Sprintf("Loaded: %s%s", privateKeyPath, privateKeyTypeSuffix(keyContent)))
 		}, pd.window)
 		fileDialog.Resize(fyne.NewSize(800, 600))
 		fileDialog.Show()
@@ -95,7 +130,7 @@ func (pd *ProfileDialog) Show(editProfile *profile.Profile, title string, onSave
 			}
 
 			publicKeyContent = keyContent
-			publicKeyLabel.SetText(fmt.Sprintf("Loaded: %s", reader.URI().Path()))
+			publicKeyLabel.SetText(fmt.Sprintf("Loaded: %s%s", reader.URI().Path(), publicKeyTypeSuffix(keyContent)))
 		}, pd.window)
         fileDialog.Resize(fyne.NewSize(800, 600))
         fileDialog.Show()
@@ -114,7 +149,8 @@ func (pd *ProfileDialog) Show(editProfile *profile.Profile, title string, onSave
                 return
             }
             privateKeyContent = keyContent
-            privateKeyLabel.SetText("Private key pasted")
+            privateKeyPath = ""
+            privateKeyLabel.SetText("Private key pasted" + privateKeyTypeSuffix(keyContent))
         }, pd.window)
         dlg.Resize(fyne.NewSize(700, 500))
         dlg.Show()
@@ -133,24 +169,125 @@ func (pd *ProfileDialog) Show(editProfile *profile.Profile, title string, onSave
                 return
             }
             publicKeyContent = keyContent
-            publicKeyLabel.SetText("Public key pasted")
+            publicKeyLabel.SetText("Public key pasted" + publicKeyTypeSuffix(keyContent))
         }, pd.window)
         dlg.Resize(fyne.NewSize(700, 400))
         dlg.Show()
     })
 
+	selectCertificateBtn := widget.NewButton("Select Certificate", func() {
+		fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			content, err := pd.readSSHKeyFile(reader, false)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("failed to read certificate: %w", err), pd.window)
+				return
+			}
+			if _, err := git.ParseSSHCertificate(content); err != nil {
+				dialog.ShowError(fmt.Errorf("invalid certificate: %w", err), pd.window)
+				return
+			}
+
+			certificateContent = content
+			certificateLabel.SetText(certificateSummary(content))
+		}, pd.window)
+		fileDialog.Resize(fyne.NewSize(800, 600))
+		fileDialog.Show()
+	})
+
+	removeCertificateBtn := widget.NewButton("Remove", func() {
+		certificateContent = ""
+		certificateLabel.SetText("No certificate (optional)")
+	})
+
+	generateBtn := widget.NewButton("Generate New Key", func() {
+		email := strings.TrimSpace(emailEntry.Text)
+		if email == "" {
+			dialog.ShowError(fmt.Errorf("enter the git email first; it becomes the key's comment"), pd.window)
+			return
+		}
+
+		passphraseEntry := widget.NewPasswordEntry()
+		passphraseEntry.SetPlaceHolder("Optional")
+		repeatEntry := widget.NewPasswordEntry()
+		form := widget.NewForm(
+			widget.NewFormItem("Passphrase", passphraseEntry),
+			widget.NewFormItem("Repeat", repeatEntry),
+		)
+		dlg := dialog.NewCustomConfirm("Generate New Key", "Generate", "Cancel", form, func(ok bool) {
+			if !ok {
+				return
+			}
+			if passphraseEntry.Text != repeatEntry.Text {
+				dialog.ShowError(fmt.Errorf("the passphrases do not match"), pd.window)
+				return
+			}
+
+			privateKey, publicKey, err := git.GenerateSSHKey(email, passphraseEntry.Text)
+			if err != nil {
+				dialog.ShowError(err, pd.window)
+				return
+			}
+
+			privateKeyContent = privateKey
+			publicKeyContent = publicKey
+			privateKeyRef = ""
+			privateKeyPath = ""
+			certificateContent = ""
+			certificateLabel.SetText("No certificate (optional)")
+			inPlaceCheck.SetChecked(false)
+			privateKeyLabel.SetText("New ed25519 key generated")
+			publicKeyLabel.SetText(fmt.Sprintf("Generated for %s", email))
+			pd.showPublicKey(publicKey)
+		}, pd.window)
+		dlg.Resize(fyne.NewSize(500, 250))
+		dlg.Show()
+	})
+
+	addDirectoryBtn := widget.NewButton("Add Directory", func() {
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil || dir == nil {
+				return
+			}
+			text := strings.TrimRight(directoriesEntry.Text, "\n")
+			if text != "" {
+				text += "\n"
+			}
+			directoriesEntry.SetText(text + dir.Path())
+		}, pd.window)
+	})
+
 	form := widget.NewForm(
 		widget.NewFormItem("Profile Name*", nameEntry),
 		widget.NewFormItem("Git Username*", usernameEntry),
 		widget.NewFormItem("Git Email*", emailEntry),
+		widget.NewFormItem("GitHub Login", loginEntry),
 	)
 
     sshContainer := container.NewVBox(
         widget.NewLabel("SSH Keys*"),
         container.NewBorder(nil, nil, container.NewHBox(selectPrivateBtn, pastePrivateBtn), nil, privateKeyLabel),
         container.NewBorder(nil, nil, container.NewHBox(selectPublicBtn, pastePublicBtn), nil, publicKeyLabel),
+        container.NewBorder(nil, nil, container.NewHBox(selectCertificateBtn, removeCertificateBtn), nil, certificateLabel),
+        container.NewHBox(generateBtn),
+        inPlaceCheck,
     )
 
+	bindingsHelp := widget.NewLabel("Repositories below these directories, or with a remote matching one of the patterns, use this profile automatically. Remote patterns win over directories.")
+	bindingsHelp.Wrapping = fyne.TextWrapWord
+
+	bindingsContainer := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("Directory Bindings"), addDirectoryBtn),
+		directoriesEntry,
+		widget.NewLabel("Remote URL Bindings"),
+		remoteURLsEntry,
+		bindingsHelp,
+	)
+
 	helpText := widget.NewLabel("* Required fields")
 	helpText.TextStyle = fyne.TextStyle{Italic: true}
 
@@ -159,6 +296,8 @@ func (pd *ProfileDialog) Show(editProfile *profile.Profile, title string, onSave
 		widget.NewSeparator(),
 		sshContainer,
 		widget.NewSeparator(),
+		bindingsContainer,
+		widget.NewSeparator(),
 		helpText,
 	)
 
@@ -174,6 +313,23 @@ func (pd *ProfileDialog) Show(editProfile *profile.Profile, title string, onSave
 			SSHPrivateKey: privateKeyContent,
 			SSHPublicKey:  publicKeyContent,
 			CreatedFrom:   "manual",
+			Directories:   splitLines(directoriesEntry.Text),
+			RemoteURLs:    splitLines(remoteURLsEntry.Text),
+
+			SSHPrivateKeyRef: privateKeyRef,
+			SSHCertificate:   certificateContent,
+			GitHubLogin:      strings.TrimSpace(loginEntry.Text),
+		}
+
+		if inPlaceCheck.Checked {
+			if privateKeyPath == "" {
+				dialog.ShowError(fmt.Errorf("a pasted private key has no file to use in place; select the key file instead"), pd.window)
+				return
+			}
+			if err := p.UseKeyFile(privateKeyPath); err != nil {
+				dialog.ShowError(fmt.Errorf("cannot use %s in place: %w", privateKeyPath, err), pd.window)
+				return
+			}
 		}
 
 		if err := p.Validate(); err != nil {
@@ -188,6 +344,26 @@ func (pd *ProfileDialog) Show(editProfile *profile.Profile, title string, onSave
 	dlg.Show()
 }
 
+// showPublicKey shows a generated public key so it can be copied to GitHub
+func (pd *ProfileDialog) showPublicKey(publicKey string) {
+	publicKey = strings.TrimSpace(publicKey)
+
+	keyLabel := widget.NewLabel(publicKey)
+	keyLabel.Wrapping = fyne.TextWrapBreak
+	keyLabel.Selectable = true
+
+	help := widget.NewLabel("Add this public key to your GitHub account under Settings > SSH and GPG keys. The key is stored once you save the profile.")
+	help.Wrapping = fyne.TextWrapWord
+
+	copyBtn := widget.NewButton("Copy Public Key", func() {
+		fyne.CurrentApp().Clipboard().SetContent(publicKey)
+	})
+
+	dlg := dialog.NewCustom("Public Key", "Close", container.NewVBox(help, keyLabel, container.NewHBox(copyBtn)), pd.window)
+	dlg.Resize(fyne.NewSize(650, 300))
+	dlg.Show()
+}
+
 func (pd *ProfileDialog) readSSHKeyFile(reader fyne.URIReadCloser, isPrivate bool) (string, error) {
 	var maxSize int64
 	if isPrivate {
@@ -214,3 +390,51 @@ func (pd *ProfileDialog) readSSHKeyFile(reader fyne.URIReadCloser, isPrivate boo
 
 	return string(data), nil
 }
+
+// certificateSummary describes a certificate for its label
+func certificateSummary(content string) string {
+	cert, err := git.ParseSSHCertificate(content)
+	if err != nil {
+		return "Invalid certificate: " + err.Error()
+	}
+	info := git.NewCertificateInfo(cert)
+	summary := "Certificate: " + info.String()
+	if warning := info.Warning(time.Now()); warning != "" {
+		summary += " (" + warning + ")"
+	}
+	return summary
+}
+
+// privateKeyTypeSuffix names the type of a private key for a label, e.g.
+// " (Ed25519)", or is empty if it cannot be told
+func privateKeyTypeSuffix(privateKey string) string {
+	t, ok, err := git.PrivateKeyType(privateKey)
+	if err != nil || !ok {
+		return ""
+	}
+	return " (" + t.Name + ")"
+}
+
+// publicKeyTypeSuffix is privateKeyTypeSuffix for a public key
+func publicKeyTypeSuffix(publicKey string) string {
+	key, err := git.ParseSSHPublicKey(publicKey)
+	if err != nil {
+		return ""
+	}
+	t, err := git.KeyTypeOf(key)
+	if err != nil {
+		return ""
+	}
+	return " (" + t.Name + ")"
+}
+
+// splitLines returns the trimmed, non-empty lines of text
+func splitLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,46 @@
+package dialogs
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// ProgressDialog shows an operation running in the background, with a
+// Cancel button to stop it
+type ProgressDialog struct {
+	dialog  *dialog.CustomDialog
+	bar     *widget.ProgressBarInfinite
+	message *widget.Label
+	cancel  *widget.Button
+}
+
+// NewProgressDialog returns a dialog showing message above an infinite
+// progress bar. Cancel calls cancel, typically a context.CancelFunc; the
+// dialog stays open until the operation notices and Hide is called.
+func NewProgressDialog(window fyne.Window, title, message string, cancel func()) *ProgressDialog {
+	pd := &ProgressDialog{
+		bar:     widget.NewProgressBarInfinite(),
+		message: widget.NewLabel(message),
+	}
+	pd.cancel = widget.NewButton("Cancel", func() {
+		pd.cancel.Disable()
+		pd.message.SetText("Cancelling...")
+		cancel()
+	})
+
+	pd.dialog = dialog.NewCustomWithoutButtons(title, container.NewVBox(pd.message, pd.bar), window)
+	pd.dialog.SetButtons([]fyne.CanvasObject{pd.cancel})
+	pd.dialog.Resize(fyne.NewSize(400, 150))
+	return pd
+}
+
+func (pd *ProgressDialog) Show() {
+	pd.dialog.Show()
+}
+
+func (pd *ProgressDialog) Hide() {
+	pd.bar.Stop()
+	pd.dialog.Hide()
+}
@@ -0,0 +1,167 @@
+package dialogs
+
+import (
+	"context"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/huzaifanur/ghpm/internal/config"
+	"github.com/huzaifanur/ghpm/internal/git"
+	"github.com/huzaifanur/ghpm/internal/secrets"
+	"github.com/huzaifanur/ghpm/pkg/logger"
+)
+
+const (
+	strategyFilesLabel = "Write keys to ~/.ssh"
+	strategyAgentLabel = "Load keys into ssh-agent"
+)
+
+// secretBackendLabels name the places private keys can be stored in
+var secretBackendLabels = map[string]string{
+	config.SecretBackendProfile: "In the profile files",
+	secrets.FileBackendName:     "In separate unencrypted files under ~/.ghpm/secrets",
+	secrets.SecretServiceName:   "In the system keyring (Secret Service)",
+}
+
+type SettingsDialog struct {
+	window     fyne.Window
+	config     *config.Config
+	gitManager *git.Manager
+	logger     *logger.Logger
+}
+
+func NewSettingsDialog(window fyne.Window, config *config.Config, gitManager *git.Manager, logger *logger.Logger) *SettingsDialog {
+	return &SettingsDialog{
+		window:     window,
+		config:     config,
+		gitManager: gitManager,
+		logger:     logger,
+	}
+}
+
+func (sd *SettingsDialog) SetConfig(cfg *config.Config) {
+	sd.config = cfg
+}
+
+func (sd *SettingsDialog) Show(onSaved func()) {
+	settings, err := sd.config.Settings()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("failed to load settings: %w", err), sd.window)
+		return
+	}
+
+	lifetimeEntry := widget.NewEntry()
+	lifetimeEntry.SetPlaceHolder("e.g. 8h; empty for no limit")
+	if settings.AgentKeyLifetime > 0 {
+		lifetimeEntry.SetText(settings.AgentKeyLifetime.String())
+	}
+
+	strategySelect := widget.NewSelect([]string{strategyFilesLabel, strategyAgentLabel}, func(selected string) {
+		if selected == strategyAgentLabel {
+			lifetimeEntry.Enable()
+		} else {
+			lifetimeEntry.Disable()
+		}
+	})
+	if settings.SwitchStrategy == git.SSHKeyStrategyAgent {
+		strategySelect.SetSelected(strategyAgentLabel)
+	} else {
+		strategySelect.SetSelected(strategyFilesLabel)
+	}
+
+	backendNames := []string{config.SecretBackendProfile, secrets.FileBackendName, secrets.SecretServiceName}
+	var backendOptions []string
+	for _, name := range backendNames {
+		backendOptions = append(backendOptions, secretBackendLabels[name])
+	}
+	backendSelect := widget.NewSelect(backendOptions, nil)
+	backendSelect.SetSelected(secretBackendLabels[settings.SecretBackend])
+
+	help := widget.NewLabel("With ssh-agent, private keys are never written to ~/.ssh; only the public keys are, " +
+		"and ~/.ssh/config points at them. The key lifetime makes the agent forget a key after that long.")
+	help.Wrapping = fyne.TextWrapWord
+
+	form := widget.NewForm(
+		widget.NewFormItem("SSH keys", strategySelect),
+		widget.NewFormItem("Agent key lifetime", lifetimeEntry),
+		widget.NewFormItem("Store private keys", backendSelect),
+		widget.NewFormItem("", help),
+	)
+
+	dlg := dialog.NewCustomConfirm("Settings", "Save", "Cancel", form, func(save bool) {
+		if !save {
+			return
+		}
+
+		previousStrategy := settings.SwitchStrategy
+		previousBackend := settings.SecretBackend
+		strategy := git.SSHKeyStrategyFiles
+		if strategySelect.Selected == strategyAgentLabel {
+			strategy = git.SSHKeyStrategyAgent
+		}
+		if err := settings.Set(config.SettingSwitchStrategy, string(strategy)); err != nil {
+			dialog.ShowError(err, sd.window)
+			return
+		}
+		if err := settings.Set(config.SettingAgentKeyLifetime, lifetimeEntry.Text); err != nil {
+			dialog.ShowError(err, sd.window)
+			return
+		}
+		for _, name := range backendNames {
+			if secretBackendLabels[name] == backendSelect.Selected {
+				settings.SecretBackend = name
+			}
+		}
+		if err := sd.config.SaveSettings(settings); err != nil {
+			dialog.ShowError(err, sd.window)
+			return
+		}
+		config.ApplySettings(sd.gitManager, settings)
+		sd.logger.Infow("Saved settings",
+			"switch_strategy", settings.SwitchStrategy,
+			"agent_key_lifetime", settings.AgentKeyLifetime,
+			"secret_backend", settings.SecretBackend)
+
+		strategyChanged := settings.SwitchStrategy != previousStrategy
+		backendChanged := settings.SecretBackend != previousBackend
+		if !strategyChanged && !backendChanged {
+			onSaved()
+			return
+		}
+		sd.apply(strategyChanged, backendChanged, settings.SecretBackend, onSaved)
+	}, sd.window)
+	dlg.Resize(fyne.NewSize(600, 350))
+	dlg.Show()
+}
+
+// apply brings key files and ssh-agent in line with a changed strategy and
+// moves private keys to a changed secret backend
+func (sd *SettingsDialog) apply(strategyChanged, backendChanged bool, backend string, onSaved func()) {
+	progressDlg := dialog.NewProgressInfinite("Applying Settings", "Updating SSH keys...", sd.window)
+	progressDlg.Show()
+
+	cfg := sd.config
+	go func() {
+		var err error
+		if strategyChanged {
+			err = cfg.Reapply(context.Background(), sd.gitManager)
+		}
+		if err == nil && backendChanged {
+			_, err = cfg.MoveSecrets(backend)
+		}
+
+		fyne.DoAndWait(func() {
+			progressDlg.Hide()
+			if config.IsUnusedSecret(err) {
+				sd.logger.Warnw("Moved private keys but kept some old ones", "error", err)
+				dialog.ShowError(err, sd.window)
+			} else if err != nil {
+				sd.logger.Errorw("Failed to apply settings", "error", err)
+				dialog.ShowError(fmt.Errorf("settings saved, but applying them failed: %w", err), sd.window)
+			}
+			onSaved()
+		})
+	}()
+}
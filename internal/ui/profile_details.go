@@ -0,0 +1,68 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/huzaifanur/ghpm/internal/profile"
+)
+
+// ProfileDetails shows the key of the selected profile: its type, its
+// fingerprints and the randomart ssh-keygen would draw for it
+type ProfileDetails struct {
+	card      *widget.Card
+	details   *widget.Label
+	randomart *widget.Label
+}
+
+func NewProfileDetails() *ProfileDetails {
+	pd := &ProfileDetails{}
+	pd.details = widget.NewLabel("")
+	pd.details.Wrapping = fyne.TextWrapBreak
+	pd.details.Selectable = true
+	pd.randomart = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	pd.card = widget.NewCard("Profile Details", "", container.NewVScroll(container.NewVBox(pd.details, pd.randomart)))
+	pd.Show(nil)
+	return pd
+}
+
+func (pd *ProfileDetails) Widget() fyne.CanvasObject {
+	return pd.card
+}
+
+// Show displays p, or a hint when no profile is selected
+func (pd *ProfileDetails) Show(p *profile.Profile) {
+	pd.randomart.SetText("")
+	if p == nil {
+		pd.card.SetSubTitle("")
+		pd.details.SetText("Select a profile to see its SSH key.")
+		return
+	}
+
+	pd.card.SetSubTitle(p.Name)
+	lines := []string{fmt.Sprintf("Git: %s <%s>", p.GitUsername, p.GitEmail)}
+	if p.IsReference() {
+		lines = append(lines, "Key file: "+p.IdentityFile)
+	}
+
+	fingerprint, err := p.Fingerprint()
+	switch {
+	case err != nil:
+		lines = append(lines, "Invalid public key: "+err.Error())
+	case fingerprint == nil:
+		lines = append(lines, "No SSH key")
+	default:
+		lines = append(lines,
+			fmt.Sprintf("Key type: %s, %d bits", fingerprint.Type.Name, fingerprint.Bits),
+			fingerprint.SHA256,
+			fingerprint.MD5)
+		if fingerprint.Comment != "" {
+			lines = append(lines, "Comment: "+fingerprint.Comment)
+		}
+		pd.randomart.SetText(fingerprint.Randomart)
+	}
+	pd.details.SetText(strings.Join(lines, "\n"))
+}
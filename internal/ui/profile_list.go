@@ -1,11 +1,14 @@
 package ui
 
 import (
+	"strings"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/huzaifanur/ghpm/internal/profile"
 )
 
 type ProfileList struct {
@@ -30,6 +33,7 @@ func (pl *ProfileList) createList() {
 				widget.NewIcon(theme.AccountIcon()),
 				widget.NewLabel("Profile Name"),
 				layout.NewSpacer(),
+				widget.NewLabelWithStyle("Fingerprint", fyne.TextAlignTrailing, fyne.TextStyle{Monospace: true}),
 				widget.NewLabel("Status"),
 			)
 		},
@@ -44,17 +48,23 @@ func (pl *ProfileList) createList() {
 
 			icon := c.Objects[0].(*widget.Icon)
 			nameLabel := c.Objects[1].(*widget.Label)
-			statusLabel := c.Objects[3].(*widget.Label)
+			fingerprintLabel := c.Objects[3].(*widget.Label)
+			statusLabel := c.Objects[4].(*widget.Label)
 
-			// Show profile name; details are visible in status panel
+			// Show profile name and key; details are in the details pane
 			nameLabel.SetText(profile.Name)
+			fingerprintLabel.SetText(fingerprintText(profile))
 
+			status := ""
+			if profile.HasEncryptedKey() {
+				status = "(passphrase)"
+			}
 			if profile.IsActive {
-				statusLabel.SetText("ACTIVE")
+				statusLabel.SetText(strings.TrimSpace("ACTIVE " + status))
 				statusLabel.TextStyle = fyne.TextStyle{Bold: true}
 				icon.SetResource(theme.ConfirmIcon())
 			} else {
-				statusLabel.SetText("")
+				statusLabel.SetText(status)
 				statusLabel.TextStyle = fyne.TextStyle{}
 				icon.SetResource(theme.AccountIcon())
 			}
@@ -64,6 +74,7 @@ func (pl *ProfileList) createList() {
     pl.list.OnSelected = func(id widget.ListItemID) {
         pl.ui.SetSelectedItem(id)
         pl.lastSelected = id
+        pl.ui.profileDetails.Show(pl.ui.GetProfiles()[id])
         if pl.ui.toolbar != nil {
             pl.ui.toolbar.UpdateButtonStates()
         }
@@ -72,6 +83,7 @@ func (pl *ProfileList) createList() {
     pl.list.OnUnselected = func(id widget.ListItemID) {
         pl.ui.SetSelectedItem(-1)
         pl.lastSelected = -1
+        pl.ui.profileDetails.Show(nil)
         if pl.ui.toolbar != nil {
             pl.ui.toolbar.UpdateButtonStates()
         }
@@ -93,3 +105,15 @@ func (pl *ProfileList) Refresh() {
 		}
 	}
 }
+
+// fingerprintText is the SHA256 fingerprint of the profile's stored key
+func fingerprintText(p *profile.Profile) string {
+	fingerprint, err := p.Fingerprint()
+	if err != nil {
+		return "invalid key"
+	}
+	if fingerprint == nil {
+		return "no SSH key"
+	}
+	return fingerprint.SHA256
+}
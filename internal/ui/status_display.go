@@ -1,28 +1,69 @@
 package ui
 
 import (
+	"context"
 	"fmt"
+	"time"
+
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"github.com/huzaifanur/ghpm/internal/config"
 	"github.com/huzaifanur/ghpm/internal/git"
+	"github.com/huzaifanur/ghpm/internal/profile"
 )
 
 type StatusDisplay struct {
-	card   *widget.Card
-	status *widget.Label
+	card      *widget.Card
+	status    *widget.Label
+	countdown *widget.Label
+	endButton *widget.Button
+	temporary *widget.Card
+
+	running *config.TemporarySwitch
 }
 
-func NewStatusDisplay() *StatusDisplay {
+// NewStatusDisplay creates the status card; onEndTemporary is called when the
+// user ends a temporary switch early
+func NewStatusDisplay(onEndTemporary func()) *StatusDisplay {
 	sd := &StatusDisplay{}
-	sd.createStatus()
+	sd.createStatus(onEndTemporary)
 	return sd
 }
 
-func (sd *StatusDisplay) createStatus() {
+func (sd *StatusDisplay) createStatus(onEndTemporary func()) {
 	sd.status = widget.NewLabel("Current Profile: Loading...")
 	sd.status.TextStyle = fyne.TextStyle{Bold: true}
-	sd.card = widget.NewCard("Current Configuration", "", sd.status)
+
+	sd.countdown = widget.NewLabel("")
+	sd.endButton = widget.NewButtonWithIcon("End Now", theme.MediaStopIcon(), onEndTemporary)
+	sd.temporary = widget.NewCard("", "", container.NewHBox(sd.countdown, sd.endButton))
+	sd.temporary.Hide()
+
+	sd.card = widget.NewCard("Current Configuration", "", container.NewVBox(sd.status, sd.temporary))
+}
+
+// Running returns the temporary switch shown by the countdown, if any
+func (sd *StatusDisplay) Running() *config.TemporarySwitch {
+	return sd.running
+}
+
+// Tick updates the countdown of a running temporary switch
+func (sd *StatusDisplay) Tick(now time.Time) {
+	if sd.running == nil {
+		sd.temporary.Hide()
+		return
+	}
+
+	remaining := sd.running.Remaining(now).Round(time.Second)
+	if remaining == 0 {
+		sd.countdown.SetText(fmt.Sprintf("Temporary switch expired; restoring '%s'...", sd.running.Previous))
+	} else {
+		sd.countdown.SetText(fmt.Sprintf("Temporary: '%s' is restored in %s (at %s)",
+			sd.running.Previous, remaining, sd.running.ExpiresAt.Local().Format("15:04")))
+	}
+	sd.temporary.Show()
 }
 
 func (sd *StatusDisplay) Widget() fyne.CanvasObject {
@@ -30,24 +71,72 @@ func (sd *StatusDisplay) Widget() fyne.CanvasObject {
 }
 
 func (sd *StatusDisplay) Update(gitManager *git.Manager, cfg *config.Config) {
+	sd.running, _ = cfg.TemporarySwitch()
+	sd.Tick(time.Now())
+
 	username, email, err := gitManager.GetCurrentGitConfig()
 	if err != nil {
 		sd.status.SetText("Current Profile: Error reading git config")
 		return
 	}
 
+	ctx := context.Background()
 	active := cfg.GetActiveProfile()
 	if active != nil {
 		status := fmt.Sprintf("Profile: %s\nGit: %s <%s>", active.Name, username, email)
 		if active.HasSSHKeys() {
-			if fingerprint, err := gitManager.GetSSHKeyFingerprint(); err == nil {
-				status += fmt.Sprintf("\nSSH: %s", fingerprint)
-			} else {
-				status += "\nSSH: Available"
+			if t, err := active.KeyType(); err == nil {
+				status += "\nKey type: " + t.Name
 			}
+			status += certificateStatus(active)
+			status += "\n" + sshStatus(ctx, gitManager, active)
 		}
 		sd.status.SetText(status)
 	} else {
-		sd.status.SetText(fmt.Sprintf("Git: %s <%s>\n(No active profile)", username, email))
+		sd.status.SetText(fmt.Sprintf("Git: %s <%s>\n(No active profile)", username, email) + "\n" + sshStatus(ctx, gitManager, nil))
+	}
+}
+
+// certificateStatus describes the profile's SSH certificate and warns when
+// it is expired or about to expire
+func certificateStatus(p *profile.Profile) string {
+	info, err := p.Certificate()
+	if err != nil {
+		return "\nWarning: " + err.Error()
+	}
+	if info == nil {
+		return ""
+	}
+
+	status := "\nCertificate: " + info.String()
+	if warning := info.Warning(time.Now()); warning != "" {
+		status += "\nWarning: " + warning
+	}
+	return status
+}
+
+// sshStatus describes the key ssh actually uses for github.com and warns
+// when it is not the key of the active profile, by path or by fingerprint
+func sshStatus(ctx context.Context, gitManager *git.Manager, active *profile.Profile) string {
+	keyPath, err := gitManager.ActiveSSHKeyPath(ctx)
+	if err != nil {
+		return "SSH: No key configured for github.com"
+	}
+
+	status := "SSH key: " + keyPath
+	if gitManager.SSHKeyStrategy() == git.SSHKeyStrategyAgent {
+		status += " (private key in ssh-agent)"
+	}
+	if fingerprint, err := gitManager.GetSSHKeyFingerprint(ctx); err == nil {
+		status += "\nSSH: " + fingerprint.String()
+	}
+	if active == nil {
+		return status
+	}
+	if expectedKeyPath := active.SSHIdentityFile(gitManager.SSHKeyStrategy()); keyPath != expectedKeyPath {
+		status += "\nWarning: ssh does not use this profile's key (" + expectedKeyPath + ")"
+	} else if err := active.VerifyActiveKey(ctx, gitManager); err != nil {
+		status += "\nWarning: " + err.Error()
 	}
+	return status
 }
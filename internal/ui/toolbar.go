@@ -3,6 +3,7 @@ package ui
 import (
     "fyne.io/fyne/v2"
     "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
     "fyne.io/fyne/v2/theme"
     "fyne.io/fyne/v2/widget"
     "github.com/huzaifanur/ghpm/internal/config"
@@ -17,6 +18,9 @@ type Toolbar struct {
     profileActions *actions.ProfileActions
     profileDialog  *dialogs.ProfileDialog
     detectDialog   *dialogs.DetectDialog
+    backupDialog   *dialogs.BackupDialog
+    historyDialog  *dialogs.HistoryDialog
+    settingsDialog *dialogs.SettingsDialog
 
     // buttons that depend on selection
     btnEdit    *widget.Button
@@ -48,6 +52,21 @@ func (tb *Toolbar) initializeComponents() {
 		tb.ui.GetConfig(),
 		tb.ui.GetLogger(),
 	)
+	tb.backupDialog = dialogs.NewBackupDialog(
+		tb.ui.GetWindow(),
+		tb.ui.GetConfig(),
+		tb.ui.GetLogger(),
+	)
+	tb.historyDialog = dialogs.NewHistoryDialog(
+		tb.ui.GetWindow(),
+		tb.ui.GetConfig(),
+	)
+	tb.settingsDialog = dialogs.NewSettingsDialog(
+		tb.ui.GetWindow(),
+		tb.ui.GetConfig(),
+		tb.ui.GetGitManager(),
+		tb.ui.GetLogger(),
+	)
 }
 
 // UpdateConfig ensures nested components always use the latest cfg instance
@@ -58,6 +77,15 @@ func (tb *Toolbar) UpdateConfig(cfg *config.Config) {
     if tb.detectDialog != nil {
         tb.detectDialog.SetConfig(cfg)
     }
+    if tb.historyDialog != nil {
+        tb.historyDialog.SetConfig(cfg)
+    }
+    if tb.backupDialog != nil {
+        tb.backupDialog.SetConfig(cfg)
+    }
+    if tb.settingsDialog != nil {
+        tb.settingsDialog.SetConfig(cfg)
+    }
 }
 
 func (tb *Toolbar) createToolbar() {
@@ -73,7 +101,11 @@ func (tb *Toolbar) createToolbar() {
 
     // Operation buttons
     tb.btnSwitch = widget.NewButtonWithIcon("Switch Profile", theme.ConfirmIcon(), tb.switchProfile)
+    undoBtn := widget.NewButtonWithIcon("Undo Switch", theme.ContentUndoIcon(), tb.undoSwitch)
+    historyBtn := widget.NewButtonWithIcon("History", theme.ListIcon(), tb.showHistory)
     testSSHBtn := widget.NewButtonWithIcon("Test SSH", theme.ComputerIcon(), tb.testSSH)
+    restoreBtn := widget.NewButtonWithIcon("Restore Backup", theme.HistoryIcon(), tb.restoreBackup)
+    settingsBtn := widget.NewButtonWithIcon("Settings", theme.SettingsIcon(), tb.showSettings)
     refreshBtn := widget.NewButtonWithIcon("Refresh", theme.ViewRefreshIcon(), tb.refresh)
 
 	// Button layout
@@ -89,8 +121,12 @@ func (tb *Toolbar) createToolbar() {
 
     bottomButtonBar := container.NewHBox(
         tb.btnSwitch,
+        undoBtn,
+        historyBtn,
         testSSHBtn,
+        restoreBtn,
         widget.NewSeparator(),
+        settingsBtn,
         refreshBtn,
     )
 
@@ -112,8 +148,10 @@ func (tb *Toolbar) showAddProfileDialog() {
 	tb.profileDialog.Show(nil, "Add Profile", func(p *profile.Profile) {
 		if err := tb.ui.GetConfig().AddProfile(p); err != nil {
 			tb.ui.GetLogger().Errorw("Failed to add profile", "error", err)
+			dialog.ShowError(err, tb.ui.GetWindow())
 			return
 		}
+		tb.profileActions.Sync()
 		tb.ui.refresh()
 		tb.ui.GetLogger().Infow("Added profile", "name", p.Name)
 	})
@@ -127,9 +165,14 @@ func (tb *Toolbar) showEditProfileDialog() {
 
 	tb.profileDialog.Show(selectedProfile, "Edit Profile", func(p *profile.Profile) {
 		if err := tb.ui.GetConfig().UpdateProfile(selectedProfile.Name, p); err != nil {
-			tb.ui.GetLogger().Errorw("Failed to update profile", "error", err)
-			return
+			dialog.ShowError(err, tb.ui.GetWindow())
+			if !config.IsUnusedSecret(err) {
+				tb.ui.GetLogger().Errorw("Failed to update profile", "error", err)
+				return
+			}
+			tb.ui.GetLogger().Warnw("Updated profile but kept its old private key", "error", err)
 		}
+		tb.profileActions.Sync()
 		tb.ui.refresh()
 		tb.ui.GetLogger().Infow("Updated profile", "name", p.Name)
 	})
@@ -160,10 +203,46 @@ func (tb *Toolbar) switchProfile() {
 	})
 }
 
+func (tb *Toolbar) undoSwitch() {
+	tb.profileActions.UndoSwitch(func() {
+		tb.ui.refresh()
+	})
+}
+
+func (tb *Toolbar) showHistory() {
+	tb.historyDialog.Show(tb.undoSwitch)
+}
+
+// EndTemporarySwitch ends a running temporary switch early
+func (tb *Toolbar) EndTemporarySwitch() {
+	tb.profileActions.EndTemporarySwitch(false, func() {
+		tb.ui.refresh()
+	})
+}
+
+// RevertExpired restores the previous profile once t has expired
+func (tb *Toolbar) RevertExpired(t *config.TemporarySwitch) {
+	tb.profileActions.RevertExpired(t, func() {
+		tb.ui.refresh()
+	})
+}
+
 func (tb *Toolbar) testSSH() {
 	tb.profileActions.TestSSH()
 }
 
+func (tb *Toolbar) restoreBackup() {
+	tb.backupDialog.Show(func() {
+		tb.ui.refresh()
+	})
+}
+
+func (tb *Toolbar) showSettings() {
+	tb.settingsDialog.Show(func() {
+		tb.ui.refresh()
+	})
+}
+
 func (tb *Toolbar) refresh() {
 	tb.ui.refresh()
 }
@@ -1,11 +1,17 @@
 package ui
 
 import (
+    "errors"
+    "fmt"
+    "time"
+
     "fyne.io/fyne/v2"
     "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
     "github.com/huzaifanur/ghpm/internal/config"
     "github.com/huzaifanur/ghpm/internal/git"
     "github.com/huzaifanur/ghpm/internal/profile"
+    "github.com/huzaifanur/ghpm/internal/ui/dialogs"
     "github.com/huzaifanur/ghpm/pkg/logger"
     "github.com/huzaifanur/ghpm/pkg/version"
 )
@@ -18,12 +24,16 @@ type UI struct {
     logger     *logger.Logger
 
     // UI components
-    profileList   *ProfileList
-    statusDisplay *StatusDisplay
-    toolbar       *Toolbar
-    footer        *Footer
-    selectedItem  int
-    profiles      []*profile.Profile
+    profileList    *ProfileList
+    profileDetails *ProfileDetails
+    statusDisplay  *StatusDisplay
+    toolbar        *Toolbar
+    footer         *Footer
+    selectedItem   int
+    profiles       []*profile.Profile
+
+    // set while the master passphrase dialog is open
+    unlocking bool
 }
 
 func NewUI(app fyne.App, cfg *config.Config) *UI {
@@ -39,10 +49,26 @@ func NewUI(app fyne.App, cfg *config.Config) *UI {
 	ui.createComponents()
 	ui.buildLayout()
 	ui.refresh()
+	go ui.watchTemporarySwitch()
 
 	return ui
 }
 
+// watchTemporarySwitch updates the countdown every second and restores the
+// previous profile once a temporary switch expires, including one that
+// expired while ghpm was not running
+func (ui *UI) watchTemporarySwitch() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		fyne.Do(func() {
+			ui.statusDisplay.Tick(now)
+			ui.toolbar.RevertExpired(ui.statusDisplay.Running())
+		})
+	}
+}
+
 func (ui *UI) Show() {
 	ui.window.ShowAndRun()
 }
@@ -54,17 +80,22 @@ func (ui *UI) setupWindow() {
 }
 
 func (ui *UI) createComponents() {
-    ui.statusDisplay = NewStatusDisplay()
+    ui.statusDisplay = NewStatusDisplay(func() {
+        ui.toolbar.EndTemporarySwitch()
+    })
+    ui.profileDetails = NewProfileDetails()
     ui.profileList = NewProfileList(ui)
     ui.toolbar = NewToolbar(ui)
     ui.footer = NewFooter("Made with ❤️ by huzaifa • v" + version.Version)
 }
 
 func (ui *UI) buildLayout() {
+    profiles := container.NewHSplit(ui.profileList.Widget(), ui.profileDetails.Widget())
+    profiles.Offset = 0.6
     content := container.NewBorder(
         container.NewVBox(ui.statusDisplay.Widget(), ui.toolbar.Widget()),
         ui.footer.Widget(), nil, nil,
-        ui.profileList.Widget(),
+        profiles,
     )
 
     ui.window.SetContent(content)
@@ -72,12 +103,22 @@ func (ui *UI) buildLayout() {
 
 func (ui *UI) refresh() {
     cfg, err := config.LoadConfig()
+    if errors.Is(err, config.ErrVaultLocked) {
+        ui.unlockVault()
+        return
+    }
     if err != nil {
         ui.logger.Errorw("Failed to load config", "error", err)
         return
     }
 
     ui.config = cfg
+    ui.gitManager.SetKnownHosts(ui.config.KnownHosts())
+    if settings, err := ui.config.Settings(); err != nil {
+        ui.logger.Errorw("Failed to load settings", "error", err)
+    } else {
+        config.ApplySettings(ui.gitManager, settings)
+    }
     ui.profiles = ui.config.GetProfiles()
     ui.profileList.Refresh()
     ui.statusDisplay.Update(ui.gitManager, ui.config)
@@ -89,6 +130,35 @@ func (ui *UI) refresh() {
     ui.logger.Infow("Refreshed profile list", "count", len(ui.profiles))
 }
 
+// unlockVault asks for the master passphrase in the background and loads
+// the profiles once the vault is open. Refresh asks again after a cancel.
+func (ui *UI) unlockVault() {
+	if ui.unlocking {
+		return
+	}
+	ui.unlocking = true
+
+	go func() {
+		err := config.NewConfig().UnlockVault(func(attempt int) (string, error) {
+			text := "Private keys are stored encrypted. Enter the master passphrase to unlock them."
+			if attempt > 1 {
+				text = "Incorrect master passphrase, try again.\n\n" + text
+			}
+			return dialogs.AskPassword(ui.window, "Unlock Profiles", "Unlock", text)
+		})
+
+		fyne.Do(func() {
+			ui.unlocking = false
+			if err != nil {
+				ui.logger.Errorw("Failed to unlock vault", "error", err)
+				dialog.ShowError(fmt.Errorf("profiles stay locked: %w", err), ui.window)
+				return
+			}
+			ui.refresh()
+		})
+	}()
+}
+
 // Getters for components to access UI state
 func (ui *UI) GetProfiles() []*profile.Profile {
 	return ui.profiles